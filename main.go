@@ -1,8 +1,13 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"strconv"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	karboscript "karboScript/src"
 
@@ -11,10 +16,23 @@ import (
 )
 
 var cli struct {
-	EBNF   bool   `help:"Display DBNF."`
-	Opcode bool   `help:"Display DBNF."`
-	Tokens bool   `help:"Display DBNF."`
-	File   string `arg:"" optional:"" type:"existingfile" help:"GraphQL schema files to parse."`
+	Run struct {
+		EBNF   bool   `help:"Display DBNF."`
+		Opcode bool   `help:"Display opcodes as assembly."`
+		Tokens bool   `help:"Display DBNF."`
+		File   string `arg:"" optional:"" type:"existingfile" help:"Script (.ks), assembly (.ksa) or compiled bytecode (.ksc) to run."`
+
+		Optimize bool `short:"O" help:"Optimize opcodes before running them."`
+
+		MaxSteps int           `help:"Maximum number of executed instructions, 0 means no limit." default:"0"`
+		Timeout  time.Duration `help:"Stop the script after given time (for example 5s), 0 means no limit." default:"0"`
+	} `cmd:"" default:"withargs" help:"Run script."`
+
+	Build struct {
+		File     string `arg:"" type:"existingfile" help:"Script to compile."`
+		Output   string `short:"o" help:"Bytecode file, defaults to the script name with .ksc extension."`
+		Optimize bool   `short:"O" help:"Optimize opcodes before writing them."`
+	} `cmd:"" help:"Compile script to bytecode file which can be run without parsing."`
 }
 
 var ctx kong.Context
@@ -23,13 +41,13 @@ func main() {
 
 	ctx := kong.Parse(&cli)
 
-	if cli.EBNF {
+	if cli.Run.EBNF {
 		fmt.Println(karboscript.Parser.String())
 		ctx.Exit(0)
 	}
 
-	if cli.Tokens {
-		tokens, symbols, err := karboscript.GetTokens(cli.File)
+	if cli.Run.Tokens {
+		tokens, symbols, err := karboscript.GetTokens(cli.Run.File)
 		ctx.FatalIfErrorf(err)
 
 		for {
@@ -58,45 +76,112 @@ func main() {
 		ctx.Exit(0)
 	}
 
-	ast, err := karboscript.Parse(cli.File)
+	if strings.HasPrefix(ctx.Command(), "build") {
+		build(ctx)
+		ctx.Exit(0)
+	}
+
+	opcodes := load(ctx, cli.Run.File)
+	if cli.Run.Optimize {
+		opcodes = optimize(ctx, opcodes)
+	}
+
+	if cli.Run.Opcode {
+		fmt.Print(karboscript.Disassemble(opcodes))
+
+		ctx.Exit(0)
+	}
+
+	runContext := context.Background()
+	if cli.Run.Timeout > 0 {
+		var cancel context.CancelFunc
+		runContext, cancel = context.WithTimeout(runContext, cli.Run.Timeout)
+		defer cancel()
+	}
+
+	err := karboscript.ExecuteWithOptions(&opcodes, karboscript.ExecuteOptions{MaxSteps: cli.Run.MaxSteps, Context: runContext})
+
+	var runtimeError *karboscript.RuntimeError
+	if errors.As(err, &runtimeError) {
+		fmt.Fprintln(os.Stderr, runtimeError.StackTrace())
+		ctx.Exit(1)
+	}
 	ctx.FatalIfErrorf(err)
+}
+
+// load reads compiled bytecode from .ksc files and assembly from .ksa files, other files are parsed as script
+func load(ctx *kong.Context, file string) []*karboscript.Opcode {
+	if filepath.Ext(file) == ".ksa" {
+		source, err := os.ReadFile(file)
+		ctx.FatalIfErrorf(err)
+
+		opcodes, err := karboscript.Assemble(string(source))
+		ctx.FatalIfErrorf(err, file)
+
+		return opcodes
+	}
+
+	if filepath.Ext(file) == ".ksc" {
+		reader, err := os.Open(file)
+		ctx.FatalIfErrorf(err)
+		defer reader.Close()
+
+		opcodes, err := karboscript.ReadBytecode(reader)
+		ctx.FatalIfErrorf(err, file)
+
+		return opcodes
+	}
+
+	ast, err := karboscript.Parse(file)
+	if err != nil {
+		reportDiagnostics(ctx, file, err)
+	}
 
 	opcodes, err := karboscript.GetOpcodes(ast)
-	ctx.FatalIfErrorf(err)
+	if err != nil {
+		reportDiagnostics(ctx, file, err)
+	}
 
-	if cli.Opcode {
-		var str string
+	return opcodes
+}
 
-		for _, opcode := range opcodes {
-			str = ""
-			if opcode.Label != nil {
-				str = str + *opcode.Label + ": "
-			}
-			str = str + opcode.Operation
-
-			if len(opcode.Arguments) > 0 {
-				str = str + " ("
-				for _, argument := range opcode.Arguments {
-
-					if argstr, ok := argument.(string); ok {
-						str = str + " " + argstr
-					} else if argint, ok := argument.(int); ok {
-						str = str + " " + strconv.FormatInt(int64(argint), 10)
-					} else if argfloat, ok := argument.(float64); ok {
-						str = str + " " + strconv.FormatFloat(argfloat, 'f', 0, 6)
-					} else if argbool, ok := argument.(bool); ok {
-						str = str + " " + strconv.FormatBool(argbool)
-					}
+func build(ctx *kong.Context) {
+	opcodes := load(ctx, cli.Build.File)
+	if cli.Build.Optimize {
+		opcodes = optimize(ctx, opcodes)
+	}
 
-				}
-				str = str + " )"
-			}
-			repr.Println(str)
-		}
+	output := cli.Build.Output
+	if output == "" {
+		output = strings.TrimSuffix(cli.Build.File, filepath.Ext(cli.Build.File)) + ".ksc"
+	}
 
-		ctx.Exit(0)
+	writer, err := os.Create(output)
+	ctx.FatalIfErrorf(err)
+
+	err = karboscript.WriteBytecode(writer, opcodes)
+	if closeErr := writer.Close(); err == nil {
+		err = closeErr
 	}
+	ctx.FatalIfErrorf(err)
+}
 
-	err = karboscript.Execute(&opcodes)
+func optimize(ctx *kong.Context, opcodes []*karboscript.Opcode) []*karboscript.Opcode {
+	optimized, err := karboscript.Optimize(opcodes)
 	ctx.FatalIfErrorf(err)
+
+	return optimized
+}
+
+func reportDiagnostics(ctx *kong.Context, file string, err error) {
+	source, readErr := os.ReadFile(file)
+	if readErr != nil {
+		source = []byte{}
+	}
+
+	for _, diagnostic := range karboscript.GetDiagnostics(err) {
+		fmt.Fprintln(os.Stderr, karboscript.FormatDiagnostic(diagnostic, string(source)))
+	}
+
+	ctx.Exit(1)
 }
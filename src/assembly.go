@@ -0,0 +1,402 @@
+package karboscript
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Assembly is text form of opcodes, every line holds one opcode:
+//
+//	label: operation ( operand operand ) @ "position"
+//
+// Label, operands and position are optional. Operands which are empty or contain spaces, quotes,
+// brackets or ':' are written as Go quoted strings. Constant of push_exp is int (1), float (1.0),
+// bool (true) or quoted string ("1"). Label can be also written on its own line, then it belongs to
+// the next opcode. Everything after ';' is comment.
+
+// Disassemble returns assembly of the opcodes, Assemble reads it back to the same opcodes
+func Disassemble(opcodes []*Opcode) string {
+	var text strings.Builder
+
+	for _, opcode := range opcodes {
+		text.WriteString(opcode.String())
+		text.WriteString("\n")
+	}
+
+	return text.String()
+}
+
+// String returns the opcode as single line of assembly
+func (opcode *Opcode) String() string {
+	text := ""
+	if opcode.Label != nil {
+		text = quoteOperand(*opcode.Label) + ": "
+	}
+	text = text + opcode.Operation.String()
+
+	if operands := opcode.operands(); len(operands) > 0 {
+		text = text + " ( " + strings.Join(operands, " ") + " )"
+	}
+
+	if opcode.Position != "" {
+		text = text + " @ " + strconv.Quote(opcode.Position)
+	}
+
+	return text
+}
+
+// operands returns operands of the opcode in the order they are written in assembly
+func (opcode *Opcode) operands() []string {
+	names := []string{}
+
+	switch opcode.Operation {
+	case OpPushExp:
+		return []string{formatConstant(opcode.Value)}
+	case OpPushExpVar, OpAddArrExp, OpPushArrCall, OpPushArrCallPeek, OpSetArrayVarExp, OpSetStructFieldExp, OpForeachInit, OpForeachEnd:
+		names = []string{opcode.Name}
+	case OpSetLocalVarArg, OpSetLocalVarExp:
+		names = []string{opcode.Type, opcode.Name}
+	case OpPushNewStruct:
+		names = append([]string{opcode.Name}, opcode.Names...)
+	case OpPushStructField, OpSetStructFieldVarExp:
+		names = opcode.Names
+	case OpExpCall, OpLogicEnd:
+		names = []string{opcode.Operator.String()}
+	case OpIf, OpAnd, OpOr, OpJmp, OpWhile, OpFor:
+		names = []string{opcode.Jump.Name}
+	case OpForincStart, OpForinc:
+		names = []string{opcode.Name, opcode.Jump.Name}
+	case OpForeachNext:
+		names = append(append([]string{opcode.Name}, opcode.Names...), opcode.Jump.Name)
+	case OpCallFunction:
+		names = []string{opcode.Name, strconv.Itoa(opcode.Count)}
+		if opcode.Type != "" {
+			names = append(names, opcode.Type)
+		}
+	}
+
+	operands := make([]string, len(names))
+	for i, name := range names {
+		operands[i] = quoteOperand(name)
+	}
+
+	return operands
+}
+
+// setOperands fills fields of the opcode from assembly operands, it's reverse of operands
+func (opcode *Opcode) setOperands(operands []assemblyToken) error {
+	count := len(operands)
+	names := make([]string, count)
+	for i, operand := range operands {
+		names[i] = operand.text
+	}
+
+	wrongCount := func(expected string) error {
+		return errors.New(opcode.Operation.String() + " needs " + expected + " operands, got " + strconv.Itoa(count) + "!")
+	}
+
+	switch opcode.Operation {
+	case OpPushExp:
+		if count != 1 {
+			return wrongCount("1")
+		}
+
+		value, err := parseConstant(operands[0])
+		if err != nil {
+			return err
+		}
+		opcode.Value = value
+	case OpPushExpVar, OpAddArrExp, OpPushArrCall, OpPushArrCallPeek, OpSetArrayVarExp, OpSetStructFieldExp, OpForeachInit, OpForeachEnd:
+		if count != 1 {
+			return wrongCount("1")
+		}
+		opcode.Name = names[0]
+	case OpSetLocalVarArg, OpSetLocalVarExp:
+		if count != 2 {
+			return wrongCount("2")
+		}
+		opcode.Type, opcode.Name = names[0], names[1]
+	case OpPushNewStruct:
+		if count%2 != 1 {
+			return wrongCount("struct name and field, type pairs as")
+		}
+		opcode.Name, opcode.Names = names[0], names[1:]
+	case OpPushStructField, OpSetStructFieldVarExp:
+		if count < 2 {
+			return wrongCount("at least 2")
+		}
+		opcode.Names = names
+	case OpExpCall, OpLogicEnd:
+		if count != 1 {
+			return wrongCount("1")
+		}
+
+		opcode.Operator = operatorFromString(names[0])
+		if opcode.Operator == OperatorNone && names[0] != "" {
+			return errors.New("Unknown operator " + names[0] + "!")
+		}
+	case OpIf, OpAnd, OpOr, OpJmp, OpWhile, OpFor:
+		if count != 1 {
+			return wrongCount("1")
+		}
+		opcode.Jump = Target{Name: names[0]}
+	case OpForincStart, OpForinc:
+		if count != 2 {
+			return wrongCount("2")
+		}
+		opcode.Name, opcode.Jump = names[0], Target{Name: names[1]}
+	case OpForeachNext:
+		if count != 4 {
+			return wrongCount("4")
+		}
+		opcode.Name, opcode.Names, opcode.Jump = names[0], names[1:3], Target{Name: names[3]}
+	case OpCallFunction:
+		if count != 2 && count != 3 {
+			return wrongCount("2 or 3")
+		}
+
+		argumentCount, err := strconv.Atoi(names[1])
+		if err != nil || argumentCount < 0 {
+			return errors.New("Number of arguments has to be integer, got " + names[1] + "!")
+		}
+
+		opcode.Name, opcode.Count = names[0], argumentCount
+		if count == 3 {
+			opcode.Type = names[2]
+		}
+		// script functions are called by jumping to their label, buildin and host functions don't have one
+		opcode.Jump = Target{Name: "_function." + opcode.Name}
+	default:
+		if count != 0 {
+			return wrongCount("0")
+		}
+	}
+
+	return nil
+}
+
+// Assemble reads opcodes written by Disassemble or by hand, returned opcodes are linked, have
+// resolved variable slots and can be passed to Execute
+func Assemble(source string) ([]*Opcode, error) {
+	operations := map[string]Operation{}
+	for operation, name := range operationNames {
+		operations[name] = Operation(operation)
+	}
+
+	opcodes := []*Opcode{}
+	var label *string
+
+	for i, line := range strings.Split(source, "\n") {
+		lineNumber := i + 1
+
+		tokens, err := tokenizeAssembly(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+
+		if len(tokens) > 0 && tokens[0].label {
+			if label != nil {
+				return nil, fmt.Errorf("line %d: Opcode can have only one label!", lineNumber)
+			}
+
+			label = &tokens[0].text
+			tokens = tokens[1:]
+		}
+
+		if len(tokens) == 0 {
+			continue
+		}
+
+		if tokens[0].quoted {
+			return nil, fmt.Errorf("line %d: Expected operation, got %q!", lineNumber, tokens[0].text)
+		}
+
+		operation, ok := operations[tokens[0].text]
+		if !ok {
+			return nil, fmt.Errorf("line %d: Unknown operation %s!", lineNumber, tokens[0].text)
+		}
+
+		opcode := &Opcode{Operation: operation, Label: label}
+		label = nil
+		tokens = tokens[1:]
+
+		operands := []assemblyToken{}
+		if len(tokens) > 0 && tokens[0].is("(") {
+			end := 1
+			for end < len(tokens) && !tokens[end].is(")") {
+				end++
+			}
+			if end == len(tokens) {
+				return nil, fmt.Errorf("line %d: Missing )!", lineNumber)
+			}
+
+			operands = tokens[1:end]
+			tokens = tokens[end+1:]
+		}
+
+		if len(tokens) > 0 && tokens[0].is("@") {
+			if len(tokens) != 2 || !tokens[1].quoted {
+				return nil, fmt.Errorf("line %d: Position has to be quoted string after @!", lineNumber)
+			}
+
+			opcode.Position = tokens[1].text
+			tokens = tokens[2:]
+		}
+
+		if len(tokens) > 0 {
+			return nil, fmt.Errorf("line %d: Unexpected %s!", lineNumber, tokens[0].text)
+		}
+
+		if err := opcode.setOperands(operands); err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+
+		opcodes = append(opcodes, opcode)
+	}
+
+	if label != nil {
+		return nil, errors.New("Label " + *label + " has no opcode!")
+	}
+
+	if err := link(opcodes); err != nil {
+		return nil, err
+	}
+
+	return opcodes, resolveSlots(opcodes)
+}
+
+type assemblyToken struct {
+	text   string
+	quoted bool
+	label  bool
+}
+
+// is reports whether the token is given unquoted symbol
+func (token assemblyToken) is(symbol string) bool {
+	return !token.quoted && token.text == symbol
+}
+
+func tokenizeAssembly(line string) ([]assemblyToken, error) {
+	tokens := []assemblyToken{}
+	characters := []rune(line)
+
+	for i := 0; i < len(characters); {
+		character := characters[i]
+
+		if unicode.IsSpace(character) {
+			i++
+			continue
+		}
+
+		if character == ';' {
+			break
+		}
+
+		if character == '(' || character == ')' || character == '@' {
+			tokens = append(tokens, assemblyToken{text: string(character)})
+			i++
+			continue
+		}
+
+		token := assemblyToken{}
+
+		if character == '"' {
+			end := i + 1
+			for end < len(characters) && characters[end] != '"' {
+				if characters[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(characters) {
+				return nil, errors.New("Unterminated string!")
+			}
+
+			text, err := strconv.Unquote(string(characters[i : end+1]))
+			if err != nil {
+				return nil, errors.New("Broken string " + string(characters[i:end+1]) + "!")
+			}
+
+			token = assemblyToken{text: text, quoted: true}
+			i = end + 1
+		} else {
+			end := i
+			for end < len(characters) && !isAssemblyDelimiter(characters[end]) && characters[end] != ':' {
+				end++
+			}
+
+			token.text = string(characters[i:end])
+			i = end
+		}
+
+		// label is the first token followed by ':'
+		if i < len(characters) && characters[i] == ':' {
+			if len(tokens) > 0 || (token.text == "" && !token.quoted) {
+				return nil, errors.New("Unexpected :!")
+			}
+
+			token.label = true
+			token.quoted = false
+			i++
+		}
+
+		tokens = append(tokens, token)
+	}
+
+	return tokens, nil
+}
+
+func isAssemblyDelimiter(character rune) bool {
+	return unicode.IsSpace(character) || strings.ContainsRune("();@\"", character)
+}
+
+// quoteOperand quotes names which couldn't be read back as single operand
+func quoteOperand(name string) string {
+	if name == "" || strings.IndexFunc(name, func(character rune) bool {
+		return isAssemblyDelimiter(character) || character == ':' || character == '\\' || !unicode.IsPrint(character)
+	}) > -1 {
+		return strconv.Quote(name)
+	}
+
+	return name
+}
+
+// formatConstant writes the value so its type is known when it's read back, floats always have '.' or exponent
+func formatConstant(value Value) string {
+	switch value.Kind() {
+	case KindString:
+		return strconv.Quote(value.String())
+	case KindFloat:
+		text := strconv.FormatFloat(value.Float(), 'g', -1, 64)
+		if math.IsInf(value.Float(), 0) || math.IsNaN(value.Float()) || strings.ContainsAny(text, ".e") {
+			return text
+		}
+		return text + ".0"
+	}
+
+	return value.String()
+}
+
+func parseConstant(token assemblyToken) (Value, error) {
+	if token.quoted {
+		return StringValue(token.text), nil
+	}
+
+	if token.text == "true" || token.text == "false" {
+		return BoolValue(token.text == "true"), nil
+	}
+
+	if integer, err := strconv.Atoi(token.text); err == nil {
+		return IntValue(integer), nil
+	}
+
+	if float, err := strconv.ParseFloat(token.text, 64); err == nil {
+		return FloatValue(float), nil
+	}
+
+	return Value{}, errors.New("Wrong constant " + token.text + "!")
+}
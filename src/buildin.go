@@ -1,45 +1,202 @@
 package karboscript
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
-	"os"
+	"io"
+	"strconv"
+	"strings"
 )
 
 type buildInFunction func(program *Program) error
 
 var buildInFunctions = map[string]buildInFunction{
 	"out":      out,
+	"outErr":   outErr,
 	"readLine": readLine,
 	"readInt":  readInt,
+	"int":      toInt,
+	"float":    toFloatFunction,
+	"len":      length,
+	"has":      has,
+	"delete":   deleteKey,
+	"keys":     keys,
+}
+
+type buildInSignature struct {
+	// arguments is nil when function accepts any number of arguments
+	arguments  []string
+	returnType string
+}
+
+var buildInSignatures = map[string]buildInSignature{
+	"out":      {nil, typeVoid},
+	"outErr":   {nil, typeVoid},
+	"readLine": {[]string{}, "string"},
+	"readInt":  {[]string{}, "int"},
+	"int":      {[]string{typeAny}, "int"},
+	"float":    {[]string{typeAny}, "float"},
+	"len":      {[]string{typeAny}, "int"},
+	"has":      {[]string{"map", typeAny}, "bool"},
+	"delete":   {[]string{"map", typeAny}, typeVoid},
+	"keys":     {[]string{"map"}, "array"},
 }
 
 func out(program *Program) error {
-	arguments := getFunctionArguments(program)
-	fmt.Println(arguments...)
+	_, err := fmt.Fprintln(program.stdout, printArguments(getFunctionArguments(program))...)
 
-	return nil
+	return err
+}
+
+func outErr(program *Program) error {
+	_, err := fmt.Fprintln(program.stderr, printArguments(getFunctionArguments(program))...)
+
+	return err
+}
+
+func printArguments(arguments []Value) []any {
+	values := make([]any, len(arguments))
+	for i, argument := range arguments {
+		values[i] = argument
+	}
+
+	return values
 }
 
 func readLine(program *Program) error {
 	getFunctionArguments(program)
-	reader := bufio.NewReader(os.Stdin)
-	text, err := reader.ReadString('\n')
 
-	if err != nil {
-		return nil
+	text, err := program.stdin.readLine(program.context)
+	if err != nil && err != io.EOF {
+		return err
 	}
 
-	program.getScope(0).pushExp(text)
+	program.push(StringValue(text))
 	return nil
 }
 
 func readInt(program *Program) error {
 	getFunctionArguments(program)
-	var out int
 
-	fmt.Scanf("%d", &out)
+	text, err := program.stdin.readLine(program.context)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	out, _ := strconv.Atoi(strings.TrimSpace(text))
+	program.push(IntValue(out))
+	return nil
+}
+
+func toInt(program *Program) error {
+	arguments := getFunctionArguments(program)
+	if len(arguments) != 1 {
+		return errors.New("int() needs exactly one argument!")
+	}
+
+	value := arguments[0]
+	switch value.Kind() {
+	case KindInt:
+		program.push(value)
+	case KindFloat:
+		program.push(IntValue(int(value.Float())))
+	case KindString:
+		out, err := strconv.Atoi(value.String())
+		if err != nil {
+			return errors.New("Can't convert \"" + value.String() + "\" to int!")
+		}
+		program.push(IntValue(out))
+	default:
+		return errors.New("Can't convert value to int!")
+	}
+
+	return nil
+}
+
+func toFloatFunction(program *Program) error {
+	arguments := getFunctionArguments(program)
+	if len(arguments) != 1 {
+		return errors.New("float() needs exactly one argument!")
+	}
+
+	value := arguments[0]
+	switch value.Kind() {
+	case KindInt:
+		program.push(FloatValue(float64(value.Int())))
+	case KindFloat:
+		program.push(value)
+	case KindString:
+		out, err := strconv.ParseFloat(value.String(), 64)
+		if err != nil {
+			return errors.New("Can't convert \"" + value.String() + "\" to float!")
+		}
+		program.push(FloatValue(out))
+	default:
+		return errors.New("Can't convert value to float!")
+	}
 
-	program.getScope(0).pushExp(out)
 	return nil
 }
+
+func length(program *Program) error {
+	arguments := getFunctionArguments(program)
+	if len(arguments) != 1 {
+		return errors.New("len() needs exactly one argument!")
+	}
+
+	value := arguments[0]
+	switch value.Kind() {
+	case KindArray:
+		program.push(IntValue(len(value.Array())))
+	case KindString:
+		program.push(IntValue(len([]rune(value.String()))))
+	case KindMap:
+		program.push(IntValue(len(value.Map().keys)))
+	default:
+		return errors.New("len() needs array, map or string!")
+	}
+
+	return nil
+}
+
+func has(program *Program) error {
+	arguments := getFunctionArguments(program)
+	if len(arguments) != 2 {
+		return errors.New("has() needs map and key as arguments!")
+	}
+
+	if mapValue := arguments[0].Map(); mapValue != nil {
+		program.push(BoolValue(mapValue.has(arguments[1])))
+		return nil
+	}
+
+	return errors.New("has() needs map as first argument!")
+}
+
+func deleteKey(program *Program) error {
+	arguments := getFunctionArguments(program)
+	if len(arguments) != 2 {
+		return errors.New("delete() needs map and key as arguments!")
+	}
+
+	if mapValue := arguments[0].Map(); mapValue != nil {
+		mapValue.delete(arguments[1])
+		return nil
+	}
+
+	return errors.New("delete() needs map as first argument!")
+}
+
+func keys(program *Program) error {
+	arguments := getFunctionArguments(program)
+	if len(arguments) != 1 {
+		return errors.New("keys() needs exactly one argument!")
+	}
+
+	if mapValue := arguments[0].Map(); mapValue != nil {
+		program.push(ArrayValue(mapValue.getKeys()))
+		return nil
+	}
+
+	return errors.New("keys() needs map as argument!")
+}
@@ -0,0 +1,409 @@
+package karboscript
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// BytecodeVersion has to be increased whenever the file layout, operations or operators change,
+// files with other version are rejected
+const BytecodeVersion = 2
+
+var bytecodeMagic = []byte("KSC\x00")
+
+var errBrokenBytecode = errors.New("Broken bytecode file!")
+
+// maxBytecodeCount limits lengths of tables and counts read from bytecode file, broken file can't
+// make the reader (or the script when it runs) allocate more than that
+const maxBytecodeCount = 1 << 24
+
+// WriteBytecode writes opcodes returned by GetOpcodes to w. The file starts with magic header and
+// version, followed by string table, constants, function table and opcodes.
+func WriteBytecode(w io.Writer, opcodes []*Opcode) error {
+	encoder := newBytecodeEncoder()
+
+	functions := [][2]int{}
+	for i, opcode := range opcodes {
+		if opcode.Label != nil && strings.HasPrefix(*opcode.Label, "_function.") {
+			functions = append(functions, [2]int{encoder.addString(strings.TrimPrefix(*opcode.Label, "_function.")), i})
+		}
+	}
+
+	body := &bytes.Buffer{}
+	writeUvarint(body, len(opcodes))
+	for _, opcode := range opcodes {
+		if err := encoder.writeOpcode(body, opcode); err != nil {
+			return err
+		}
+	}
+
+	file := bufio.NewWriter(w)
+	file.Write(bytecodeMagic)
+	binary.Write(file, binary.BigEndian, uint16(BytecodeVersion))
+
+	writeUvarint(file, len(encoder.strings))
+	for _, text := range encoder.strings {
+		writeUvarint(file, len(text))
+		file.WriteString(text)
+	}
+
+	writeUvarint(file, len(encoder.constants))
+	for _, constant := range encoder.constants {
+		file.WriteByte(byte(constant.Kind()))
+		switch constant.Kind() {
+		case KindInt, KindBool:
+			writeVarint(file, constant.Int())
+		case KindFloat:
+			binary.Write(file, binary.BigEndian, math.Float64bits(constant.Float()))
+		case KindString:
+			writeUvarint(file, encoder.stringIndexes[constant.String()])
+		}
+	}
+
+	writeUvarint(file, len(functions))
+	for _, function := range functions {
+		writeUvarint(file, function[0])
+		writeUvarint(file, function[1])
+	}
+
+	file.Write(body.Bytes())
+
+	return file.Flush()
+}
+
+// ReadBytecode reads opcodes written by WriteBytecode, they can be passed to Execute
+func ReadBytecode(r io.Reader) ([]*Opcode, error) {
+	file := bufio.NewReader(r)
+
+	magic := make([]byte, len(bytecodeMagic))
+	if _, err := io.ReadFull(file, magic); err != nil || !bytes.Equal(magic, bytecodeMagic) {
+		return nil, errors.New("File is not KarboScript bytecode!")
+	}
+
+	var version uint16
+	if err := binary.Read(file, binary.BigEndian, &version); err != nil {
+		return nil, errBrokenBytecode
+	}
+	if version != BytecodeVersion {
+		return nil, fmt.Errorf("Bytecode version %d is not supported, this karboscript runs version %d, build the script again!", version, BytecodeVersion)
+	}
+
+	decoder := &bytecodeDecoder{reader: file}
+
+	// slices grow while their items are read, so broken file declaring huge length can't allocate much memory
+	count := decoder.readLength()
+	for i := 0; i < count && decoder.err == nil; i++ {
+		decoder.strings = append(decoder.strings, decoder.readText())
+	}
+
+	count = decoder.readLength()
+	for i := 0; i < count && decoder.err == nil; i++ {
+		decoder.constants = append(decoder.constants, decoder.readConstant())
+	}
+
+	functions := [][2]int{}
+	count = decoder.readLength()
+	for i := 0; i < count && decoder.err == nil; i++ {
+		functions = append(functions, [2]int{decoder.readUvarint(), decoder.readUvarint()})
+	}
+
+	opcodes := []*Opcode{}
+	count = decoder.readLength()
+	for i := 0; i < count && decoder.err == nil; i++ {
+		opcodes = append(opcodes, decoder.readOpcode())
+	}
+
+	if decoder.err != nil {
+		return nil, decoder.err
+	}
+
+	for _, opcode := range opcodes {
+		if opcode.Jump.linked && opcode.Jump.Index >= len(opcodes) {
+			return nil, errBrokenBytecode
+		}
+	}
+
+	for _, function := range functions {
+		name, index := function[0], function[1]
+		if name >= len(decoder.strings) || index >= len(opcodes) {
+			return nil, errBrokenBytecode
+		}
+
+		label := opcodes[index].Label
+		if label == nil || *label != "_function."+decoder.strings[name] {
+			return nil, errBrokenBytecode
+		}
+	}
+
+	// slots aren't stored, they are resolved again from variable names
+	if err := resolveSlots(opcodes); err != nil {
+		return nil, errBrokenBytecode
+	}
+
+	return opcodes, nil
+}
+
+type bytecodeEncoder struct {
+	strings         []string
+	stringIndexes   map[string]int
+	constants       []Value
+	constantIndexes map[Value]int
+}
+
+func newBytecodeEncoder() *bytecodeEncoder {
+	return &bytecodeEncoder{[]string{}, map[string]int{}, []Value{}, map[Value]int{}}
+}
+
+func (encoder *bytecodeEncoder) addString(text string) int {
+	if index, ok := encoder.stringIndexes[text]; ok {
+		return index
+	}
+
+	encoder.strings = append(encoder.strings, text)
+	encoder.stringIndexes[text] = len(encoder.strings) - 1
+
+	return len(encoder.strings) - 1
+}
+
+func (encoder *bytecodeEncoder) addConstant(value Value) (int, error) {
+	if !value.isScalar() {
+		return 0, errors.New("Can't write " + value.TypeName() + " constant to bytecode!")
+	}
+
+	if index, ok := encoder.constantIndexes[value]; ok {
+		return index, nil
+	}
+
+	if value.Kind() == KindString {
+		encoder.addString(value.String())
+	}
+
+	encoder.constants = append(encoder.constants, value)
+	encoder.constantIndexes[value] = len(encoder.constants) - 1
+
+	return len(encoder.constants) - 1, nil
+}
+
+// writeOpcode writes operation and operator followed by operands, optional operands are stored as index + 1
+func (encoder *bytecodeEncoder) writeOpcode(w *bytes.Buffer, opcode *Opcode) error {
+	w.WriteByte(byte(opcode.Operation))
+	w.WriteByte(byte(opcode.Operator))
+
+	label := 0
+	if opcode.Label != nil {
+		label = encoder.addString(*opcode.Label) + 1
+	}
+	writeUvarint(w, label)
+
+	constant := 0
+	if opcode.Value.Kind() != KindNil {
+		index, err := encoder.addConstant(opcode.Value)
+		if err != nil {
+			return err
+		}
+		constant = index + 1
+	}
+	writeUvarint(w, constant)
+
+	writeUvarint(w, encoder.addString(opcode.Name))
+	writeUvarint(w, encoder.addString(opcode.Type))
+	writeVarint(w, opcode.Count)
+
+	writeUvarint(w, len(opcode.Names))
+	for _, name := range opcode.Names {
+		writeUvarint(w, encoder.addString(name))
+	}
+
+	writeUvarint(w, encoder.addString(opcode.Jump.Name))
+	jump := 0
+	if opcode.Jump.linked {
+		jump = opcode.Jump.Index + 1
+	}
+	writeUvarint(w, jump)
+
+	writeUvarint(w, encoder.addString(opcode.Position))
+
+	return nil
+}
+
+// bytecodeDecoder remembers the first error so the reading doesn't have to be checked after every value
+type bytecodeDecoder struct {
+	reader    *bufio.Reader
+	strings   []string
+	constants []Value
+	err       error
+}
+
+func (decoder *bytecodeDecoder) readUvarint() int {
+	if decoder.err != nil {
+		return 0
+	}
+
+	value, err := binary.ReadUvarint(decoder.reader)
+	if err != nil || value > math.MaxInt32 {
+		decoder.err = errBrokenBytecode
+		return 0
+	}
+
+	return int(value)
+}
+
+// readLength reads number of following items or bytes
+func (decoder *bytecodeDecoder) readLength() int {
+	length := decoder.readUvarint()
+	if length > maxBytecodeCount {
+		decoder.err = errBrokenBytecode
+		return 0
+	}
+
+	return length
+}
+
+func (decoder *bytecodeDecoder) readVarint() int {
+	if decoder.err != nil {
+		return 0
+	}
+
+	value, err := binary.ReadVarint(decoder.reader)
+	if err != nil {
+		decoder.err = errBrokenBytecode
+		return 0
+	}
+
+	return int(value)
+}
+
+func (decoder *bytecodeDecoder) readByte() byte {
+	if decoder.err != nil {
+		return 0
+	}
+
+	value, err := decoder.reader.ReadByte()
+	if err != nil {
+		decoder.err = errBrokenBytecode
+	}
+
+	return value
+}
+
+// readText reads string of the string table
+func (decoder *bytecodeDecoder) readText() string {
+	length := decoder.readLength()
+	if decoder.err != nil {
+		return ""
+	}
+
+	var text strings.Builder
+	if written, err := io.CopyN(&text, decoder.reader, int64(length)); err != nil || written != int64(length) {
+		decoder.err = errBrokenBytecode
+	}
+
+	return text.String()
+}
+
+func (decoder *bytecodeDecoder) readString() string {
+	index := decoder.readUvarint()
+	if decoder.err != nil {
+		return ""
+	}
+
+	if index >= len(decoder.strings) {
+		decoder.err = errBrokenBytecode
+		return ""
+	}
+
+	return decoder.strings[index]
+}
+
+func (decoder *bytecodeDecoder) readConstant() Value {
+	switch Kind(decoder.readByte()) {
+	case KindInt:
+		return IntValue(decoder.readVarint())
+	case KindBool:
+		return BoolValue(decoder.readVarint() != 0)
+	case KindFloat:
+		var bits uint64
+		if decoder.err == nil && binary.Read(decoder.reader, binary.BigEndian, &bits) != nil {
+			decoder.err = errBrokenBytecode
+		}
+		return FloatValue(math.Float64frombits(bits))
+	case KindString:
+		return StringValue(decoder.readString())
+	}
+
+	if decoder.err == nil {
+		decoder.err = errBrokenBytecode
+	}
+
+	return Value{}
+}
+
+func (decoder *bytecodeDecoder) readOpcode() *Opcode {
+	opcode := &Opcode{}
+
+	opcode.Operation = Operation(decoder.readByte())
+	opcode.Operator = Operator(decoder.readByte())
+	if opcode.Operation >= operationCount || opcode.Operator >= operatorCount {
+		decoder.err = errBrokenBytecode
+		return opcode
+	}
+
+	if label := decoder.readUvarint(); label > 0 {
+		if label > len(decoder.strings) {
+			decoder.err = errBrokenBytecode
+			return opcode
+		}
+		opcode.Label = &decoder.strings[label-1]
+	}
+
+	if constant := decoder.readUvarint(); constant > 0 {
+		if constant > len(decoder.constants) {
+			decoder.err = errBrokenBytecode
+			return opcode
+		}
+		opcode.Value = decoder.constants[constant-1]
+	}
+
+	opcode.Name = decoder.readString()
+	opcode.Type = decoder.readString()
+	opcode.Count = decoder.readVarint()
+	if opcode.Count < 0 || opcode.Count > maxBytecodeCount {
+		decoder.err = errBrokenBytecode
+		return opcode
+	}
+
+	count := decoder.readLength()
+	for i := 0; i < count && decoder.err == nil; i++ {
+		opcode.Names = append(opcode.Names, decoder.readString())
+	}
+
+	opcode.Jump.Name = decoder.readString()
+	if jump := decoder.readUvarint(); jump > 0 {
+		opcode.Jump.Index = jump - 1
+		opcode.Jump.linked = true
+	}
+
+	opcode.Position = decoder.readString()
+
+	return opcode
+}
+
+func writeUvarint(w io.ByteWriter, value int) {
+	buffer := make([]byte, binary.MaxVarintLen64)
+	for _, b := range buffer[:binary.PutUvarint(buffer, uint64(value))] {
+		w.WriteByte(b)
+	}
+}
+
+func writeVarint(w io.ByteWriter, value int) {
+	buffer := make([]byte, binary.MaxVarintLen64)
+	for _, b := range buffer[:binary.PutVarint(buffer, int64(value))] {
+		w.WriteByte(b)
+	}
+}
@@ -0,0 +1,865 @@
+package karboscript
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+const (
+	// typeAny is used for values which type is known only at runtime (array elements, map values, ...)
+	typeAny = "any"
+	// typeVoid is used for functions which don't return any value
+	typeVoid = "void"
+)
+
+type CheckedCode struct {
+	functions map[string]*Function
+	structs   map[string]*Struct
+	globals   map[string]string
+	constants map[string]bool
+	// scopes hold variables of blocks of the checked function, the first one holds its arguments
+	scopes      []map[string]string
+	function    *Function
+	loopDepth   int
+	diagnostics Diagnostics
+	hosts       map[string]hostFunction
+}
+
+func (checked *CheckedCode) addError(pos lexer.Position, message string) {
+	checked.diagnostics = append(checked.diagnostics, newDiagnostic(pos, message))
+}
+
+func (checked *CheckedCode) isKnownType(name string) bool {
+	for _, buildInType := range buildInTypes {
+		if buildInType == name {
+			return true
+		}
+	}
+
+	_, ok := checked.structs[name]
+	return ok
+}
+
+func (checked *CheckedCode) checkType(pos lexer.Position, name string) {
+	if !checked.isKnownType(name) {
+		checked.addError(pos, "unknown type "+name+"!")
+	}
+}
+
+func (checked *CheckedCode) getVariableType(name string) (string, bool) {
+	for i := len(checked.scopes) - 1; i >= 0; i-- {
+		if varType, ok := checked.scopes[i][name]; ok {
+			return varType, true
+		}
+	}
+
+	varType, ok := checked.globals[name]
+	return varType, ok
+}
+
+// checkNotConstant reports assignment to global constant, variable of the function (like its
+// argument) with the same name hides the constant
+func (checked *CheckedCode) checkNotConstant(pos lexer.Position, name string) bool {
+	for _, scope := range checked.scopes {
+		if _, ok := scope[name]; ok {
+			return true
+		}
+	}
+
+	if checked.constants[name] {
+		checked.addError(pos, "can't assign to constant "+name+"!")
+		return false
+	}
+
+	return true
+}
+
+// setVariableType declares variable in the current block. Function has single slot for every
+// variable name, so variable of outer block can be declared again only with the same type.
+func (checked *CheckedCode) setVariableType(pos lexer.Position, name string, varType string) {
+	if len(checked.scopes) == 0 {
+		checked.globals[name] = varType
+		return
+	}
+
+	for i := len(checked.scopes) - 1; i >= 0; i-- {
+		if outerType, ok := checked.scopes[i][name]; ok {
+			if i < len(checked.scopes)-1 && outerType != varType {
+				checked.addError(pos, "variable "+name+" is already declared as "+outerType+"!")
+				return
+			}
+
+			checked.scopes[i][name] = varType
+			return
+		}
+	}
+
+	checked.scopes[len(checked.scopes)-1][name] = varType
+}
+
+func (checked *CheckedCode) pushScope() {
+	checked.scopes = append(checked.scopes, map[string]string{})
+}
+
+func (checked *CheckedCode) popScope() {
+	checked.scopes = checked.scopes[0 : len(checked.scopes)-1]
+}
+
+// Check runs semantic analysis over the code and returns Diagnostics with every problem found
+func Check(code *Code) Diagnostics {
+	return check(code, nil, true)
+}
+
+// check reports problems of the code, script compiled for Script.Call doesn't need main function
+func check(code *Code, hosts map[string]hostFunction, requireMain bool) Diagnostics {
+	checked := CheckedCode{map[string]*Function{}, map[string]*Struct{}, map[string]string{}, map[string]bool{}, nil, nil, 0, Diagnostics{}, hosts}
+
+	for _, structDeclaration := range code.Structs {
+		if checked.isKnownType(structDeclaration.Name) {
+			checked.addError(structDeclaration.Pos, "type "+structDeclaration.Name+" is already declared")
+			continue
+		}
+		checked.structs[structDeclaration.Name] = structDeclaration
+	}
+	for _, function := range code.Functions {
+		if _, ok := checked.functions[function.Name]; ok {
+			checked.addError(function.Pos, "function "+function.Name+" is already declared")
+			continue
+		}
+		if _, ok := checked.structs[function.Name]; ok {
+			checked.addError(function.Pos, function.Name+" is declared as struct and function")
+			continue
+		}
+		if _, ok := buildInFunctions[function.Name]; ok {
+			checked.addError(function.Pos, "function "+function.Name+" is buildin function")
+			continue
+		}
+		if _, ok := checked.hosts[function.Name]; ok {
+			checked.addError(function.Pos, "function "+function.Name+" is already registered by the runtime")
+			continue
+		}
+		checked.functions[function.Name] = function
+	}
+
+	for _, structDeclaration := range code.Structs {
+		fields := map[string]bool{}
+
+		for _, field := range structDeclaration.Fields {
+			if fields[field.Name] {
+				checked.addError(field.Pos, "field "+field.Name+" is already declared in "+structDeclaration.Name)
+			}
+			fields[field.Name] = true
+
+			checked.checkType(field.Pos, field.VarType.Value)
+		}
+	}
+
+	for _, global := range code.Globals {
+		if _, ok := checked.globals[global.Variable.Value]; ok {
+			checked.addError(global.Pos, "global variable "+global.Variable.Value+" is already declared")
+		}
+
+		checked.checkType(global.Pos, global.VarType.Value)
+		expressionType := checkExpression(&checked, &global.Expression)
+		checkAssignable(&checked, global.Pos, global.VarType.Value, expressionType, "variable "+global.Variable.Value)
+		checked.setVariableType(global.Pos, global.Variable.Value, global.VarType.Value)
+
+		if global.Const {
+			checked.constants[global.Variable.Value] = true
+		}
+	}
+
+	if _, ok := checked.functions["main"]; !ok && requireMain {
+		checked.addError(lexer.Position{Line: 1, Column: 1}, "Can't find main function!")
+	}
+
+	for _, function := range code.Functions {
+		checkFunction(&checked, function)
+	}
+
+	return checked.diagnostics
+}
+
+func checkFunction(checked *CheckedCode, function *Function) {
+	checked.function = function
+	checked.pushScope()
+
+	if function.ReturnType != nil {
+		checked.checkType(function.Pos, function.ReturnType.Value)
+	}
+
+	for _, argument := range function.Arguments {
+		checked.checkType(argument.Pos, argument.VarType.Value)
+		checked.setVariableType(argument.Pos, argument.Variable.Value, argument.VarType.Value)
+	}
+
+	checkBody(checked, function.Body)
+
+	if function.ReturnType != nil && !alwaysReturns(function.Body) {
+		checked.addError(function.Pos, "function "+function.Name+" has to return "+function.ReturnType.Value+"!")
+	}
+
+	checked.popScope()
+	checked.function = nil
+}
+
+// checkBody checks statements of block, variables declared in the block can't be used after it
+func checkBody(checked *CheckedCode, statements []*Statement) {
+	checked.pushScope()
+	for _, statement := range statements {
+		checkStatement(checked, statement)
+	}
+	checked.popScope()
+}
+
+// alwaysReturns reports whether every path through the statements ends with return
+func alwaysReturns(statements []*Statement) bool {
+	if len(statements) == 0 {
+		return false
+	}
+
+	last := statements[len(statements)-1]
+	if last.ReturnStmt != nil {
+		return true
+	}
+
+	for ifStmt := last.If; ifStmt != nil; ifStmt = ifStmt.Else.If {
+		if !alwaysReturns(ifStmt.Body) || ifStmt.Else == nil {
+			return false
+		}
+		if ifStmt.Else.If == nil {
+			return alwaysReturns(ifStmt.Else.Body)
+		}
+	}
+
+	return false
+}
+
+// containsReturn reports if any of statements (or statements of their blocks) is return
+func containsReturn(statements []*Statement) bool {
+	for _, statement := range statements {
+		switch {
+		case statement.ReturnStmt != nil:
+			return true
+		case statement.If != nil:
+			for ifStmt := statement.If; ifStmt != nil; ifStmt = ifStmt.Else.If {
+				if containsReturn(ifStmt.Body) {
+					return true
+				}
+				if ifStmt.Else == nil {
+					break
+				}
+				if ifStmt.Else.If == nil && containsReturn(ifStmt.Else.Body) {
+					return true
+				}
+			}
+		case statement.For != nil && containsReturn(statement.For.Body),
+			statement.ForInc != nil && containsReturn(statement.ForInc.Body),
+			statement.Foreach != nil && containsReturn(statement.Foreach.Body),
+			statement.While != nil && containsReturn(statement.While.Body):
+			return true
+		}
+	}
+
+	return false
+}
+
+func checkStatement(checked *CheckedCode, statement *Statement) {
+	if statement.FunctionCall != nil {
+		checkFunctionCall(checked, statement.FunctionCall)
+	}
+	if statement.Expression != nil {
+		checkExpression(checked, statement.Expression)
+	}
+	if statement.ReturnStmt != nil {
+		checkReturnStmt(checked, statement.ReturnStmt)
+	}
+	if statement.Assigment != nil {
+		checkAssigment(checked, statement.Assigment)
+	}
+	if statement.ArrayAssigment != nil {
+		checkArrayAssigment(checked, statement.ArrayAssigment)
+	}
+	if statement.FieldAssigment != nil {
+		checkFieldAssigment(checked, statement.FieldAssigment)
+	}
+	if statement.If != nil {
+		checkIf(checked, statement.If)
+	}
+	if statement.While != nil {
+		checkCondition(checked, &statement.While.Condition)
+		checkLoopBody(checked, statement.While.Body)
+	}
+	if statement.For != nil {
+		// variable declared by init belongs only to the loop
+		checked.pushScope()
+		checkStatement(checked, &statement.For.Init)
+		checkCondition(checked, &statement.For.Condition)
+		checkLoopBody(checked, statement.For.Body)
+		checkStatement(checked, &statement.For.Increment)
+		checked.popScope()
+	}
+	if statement.ForInc != nil {
+		checkForInc(checked, statement.ForInc)
+	}
+	if statement.Foreach != nil {
+		checkForeach(checked, statement.Foreach)
+	}
+	if statement.Break != nil && checked.loopDepth == 0 {
+		checked.addError(statement.Break.Pos, "break used outside of loop!")
+	}
+	if statement.Continue != nil && checked.loopDepth == 0 {
+		checked.addError(statement.Continue.Pos, "continue used outside of loop!")
+	}
+}
+
+func checkLoopBody(checked *CheckedCode, statements []*Statement) {
+	checked.loopDepth++
+	checkBody(checked, statements)
+	checked.loopDepth--
+}
+
+func checkIf(checked *CheckedCode, ifStmt *If) {
+	checkCondition(checked, &ifStmt.Condition)
+	checkBody(checked, ifStmt.Body)
+
+	if ifStmt.Else != nil {
+		if ifStmt.Else.If != nil {
+			checkIf(checked, ifStmt.Else.If)
+		} else {
+			checkBody(checked, ifStmt.Else.Body)
+		}
+	}
+}
+
+func checkCondition(checked *CheckedCode, expression *Expression) {
+	conditionType := checkExpression(checked, expression)
+
+	if conditionType != "bool" && conditionType != typeAny {
+		checked.addError(expression.Pos, "Condition must return bool")
+	}
+}
+
+func checkForInc(checked *CheckedCode, forStmt *ForInc) {
+	for _, expression := range []*Expression{&forStmt.ExpressionA, &forStmt.ExpressionB} {
+		expressionType := checkExpression(checked, expression)
+		if expressionType != "int" && expressionType != typeAny {
+			checked.addError(expression.Pos, "from-to range needs int, got "+expressionType+"!")
+		}
+	}
+
+	checked.pushScope()
+	checked.setVariableType(forStmt.Pos, forStmt.Variable.Value, "int")
+	checkLoopBody(checked, forStmt.Body)
+	checked.popScope()
+}
+
+func checkForeach(checked *CheckedCode, foreach *Foreach) {
+	collectionType := checkExpression(checked, &foreach.Collection)
+
+	keyType := typeAny
+	switch collectionType {
+	case "array":
+		keyType = "int"
+	case "map", typeAny:
+	default:
+		checked.addError(foreach.Collection.Pos, "foreach needs array or map, got "+collectionType+"!")
+	}
+
+	checked.pushScope()
+	if foreach.Key != nil {
+		checked.setVariableType(foreach.Pos, foreach.Key.Value, keyType)
+	}
+	checked.setVariableType(foreach.Pos, foreach.Value.Value, typeAny)
+
+	checkLoopBody(checked, foreach.Body)
+	checked.popScope()
+}
+
+func checkReturnStmt(checked *CheckedCode, returnStmt *ReturnStmt) {
+	expressionType := checkValue(checked, &returnStmt.Expression)
+
+	if checked.function == nil || checked.function.ReturnType == nil {
+		return
+	}
+
+	returnType := checked.function.ReturnType.Value
+	if !isAssignable(returnType, expressionType) {
+		checked.addError(returnStmt.Pos, "function "+checked.function.Name+" has to return "+returnType+", got "+expressionType+"!")
+	}
+}
+
+func isAssignable(target string, source string) bool {
+	if source == typeVoid {
+		return false
+	}
+
+	return target == typeAny || source == typeAny || target == source
+}
+
+func checkAssignable(checked *CheckedCode, pos lexer.Position, target string, source string, name string) {
+	if source == typeVoid {
+		checked.addError(pos, "expression assigned to "+name+" doesn't return any value!")
+		return
+	}
+
+	if !isAssignable(target, source) {
+		checked.addError(pos, "can't assign "+source+" to "+target+" "+name+"!")
+	}
+}
+
+// checkCompoundValue returns type of value computed by compound assignment operator like += or ++
+func checkCompoundValue(checked *CheckedCode, pos lexer.Position, currentType string, operator string, increment string, expression *Expression) string {
+	if increment != "" {
+		return checkMathOperation(checked, pos, increment[0:1], currentType, "int")
+	}
+
+	expressionType := checkExpression(checked, expression)
+	if operator == "=" {
+		return expressionType
+	}
+
+	return checkMathOperation(checked, pos, operator[0:1], currentType, expressionType)
+}
+
+func checkAssigment(checked *CheckedCode, assigment *Assigment) {
+	name := assigment.Variable.Value
+	currentType, declared := checked.getVariableType(name)
+
+	// typed declaration makes variable of the function which hides constant
+	if assigment.VarType.Value == "" && !checked.checkNotConstant(assigment.Pos, name) {
+		return
+	}
+
+	if assigment.VarType.Value != "" {
+		checked.checkType(assigment.Pos, assigment.VarType.Value)
+
+		if assigment.Operator != "=" && !declared {
+			checked.addError(assigment.Variable.Pos, "Undeclared variable: "+name)
+			return
+		}
+
+		valueType := checkCompoundValue(checked, assigment.Pos, currentType, assigment.Operator, assigment.Increment, assigment.Expression)
+		checkAssignable(checked, assigment.Pos, assigment.VarType.Value, valueType, "variable "+name)
+		checked.setVariableType(assigment.Pos, name, assigment.VarType.Value)
+		return
+	}
+
+	if !declared {
+		checked.addError(assigment.Variable.Pos, "Undeclared variable: "+name)
+		if assigment.Expression != nil {
+			checkExpression(checked, assigment.Expression)
+		}
+		return
+	}
+
+	valueType := checkCompoundValue(checked, assigment.Pos, currentType, assigment.Operator, assigment.Increment, assigment.Expression)
+	checkAssignable(checked, assigment.Pos, currentType, valueType, "variable "+name)
+}
+
+func checkArrayAssigment(checked *CheckedCode, assigment *ArrayAssigment) {
+	name := assigment.Variable.Value
+	varType, declared := checked.getVariableType(name)
+
+	if !checked.checkNotConstant(assigment.Pos, name) {
+		return
+	}
+
+	if !declared {
+		checked.addError(assigment.Variable.Pos, "Undeclared variable: "+name)
+		varType = typeAny
+	}
+
+	if assigment.Index == nil && assigment.Operator != "=" {
+		checked.addError(assigment.Pos, "can't use "+assigment.Operator+assigment.Increment+" when pushing to array!")
+		return
+	}
+
+	switch varType {
+	case "array":
+		if assigment.Index != nil {
+			indexType := checkExpression(checked, assigment.Index)
+			if indexType != "int" && indexType != typeAny {
+				checked.addError(assigment.Index.Pos, "Index is not integer!")
+			}
+		}
+	case "map":
+		if assigment.Index == nil {
+			checked.addError(assigment.Pos, "can't push to map "+name+"!")
+		} else {
+			checkMapKey(checked, assigment.Index)
+		}
+	case typeAny:
+		if assigment.Index != nil {
+			checkExpression(checked, assigment.Index)
+		}
+	default:
+		checked.addError(assigment.Pos, "variable "+name+" is not array!")
+		return
+	}
+
+	checkCompoundValue(checked, assigment.Pos, typeAny, assigment.Operator, assigment.Increment, assigment.Expression)
+}
+
+func checkFieldAssigment(checked *CheckedCode, assigment *FieldAssigment) {
+	if !checked.checkNotConstant(assigment.Pos, assigment.Variable.Value) {
+		return
+	}
+
+	fieldType := checkFieldPath(checked, assigment.Pos, assigment.Variable.Value, assigment.Fields)
+
+	valueType := checkCompoundValue(checked, assigment.Pos, fieldType, assigment.Operator, assigment.Increment, assigment.Expression)
+	checkAssignable(checked, assigment.Pos, fieldType, valueType, "field "+assigment.Variable.Value+"."+strings.Join(assigment.Fields, "."))
+}
+
+func checkFieldPath(checked *CheckedCode, pos lexer.Position, name string, fields []string) string {
+	varType, declared := checked.getVariableType(name)
+	if !declared {
+		checked.addError(pos, "Undeclared variable: "+name)
+		return typeAny
+	}
+
+	for _, field := range fields {
+		if varType == typeAny {
+			return typeAny
+		}
+
+		structDeclaration, ok := checked.structs[varType]
+		if !ok {
+			checked.addError(pos, "variable is not struct!")
+			return typeAny
+		}
+
+		found := false
+		for _, structField := range structDeclaration.Fields {
+			if structField.Name == field {
+				varType = structField.VarType.Value
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			checked.addError(pos, structDeclaration.Name+" has no field "+field+"!")
+			return typeAny
+		}
+	}
+
+	return varType
+}
+
+func checkMapKey(checked *CheckedCode, expression *Expression) {
+	keyType := checkExpression(checked, expression)
+
+	switch keyType {
+	case "string", "int", "float", "bool", typeAny:
+	default:
+		checked.addError(expression.Pos, "Map key must be string, int, float or bool!")
+	}
+}
+
+func checkArguments(checked *CheckedCode, functionCall *FunctionCall, argumentTypes []string) {
+	if len(functionCall.Arguments) != len(argumentTypes) {
+		checked.addError(functionCall.Pos, functionCall.FunctionName+" needs "+strconv.Itoa(len(argumentTypes))+" arguments, got "+strconv.Itoa(len(functionCall.Arguments))+"!")
+	}
+
+	for i, argument := range functionCall.Arguments {
+		argumentType := checkExpression(checked, argument)
+
+		if i >= len(argumentTypes) {
+			continue
+		}
+
+		if !isAssignable(argumentTypes[i], argumentType) {
+			checked.addError(argument.Pos, "argument "+strconv.Itoa(i+1)+" of "+functionCall.FunctionName+" has to be "+argumentTypes[i]+", got "+argumentType+"!")
+		}
+	}
+}
+
+func checkFunctionCall(checked *CheckedCode, functionCall *FunctionCall) string {
+	if structDeclaration, ok := checked.structs[functionCall.FunctionName]; ok {
+		fieldTypes := []string{}
+		for _, field := range structDeclaration.Fields {
+			fieldTypes = append(fieldTypes, field.VarType.Value)
+		}
+
+		checkArguments(checked, functionCall, fieldTypes)
+		return structDeclaration.Name
+	}
+
+	if function, ok := checked.functions[functionCall.FunctionName]; ok {
+		argumentTypes := []string{}
+		for _, argument := range function.Arguments {
+			argumentTypes = append(argumentTypes, argument.VarType.Value)
+		}
+
+		checkArguments(checked, functionCall, argumentTypes)
+
+		if function.ReturnType != nil {
+			return function.ReturnType.Value
+		}
+		// function without return type can still return value of any type
+		if containsReturn(function.Body) {
+			return typeAny
+		}
+		return typeVoid
+	}
+
+	if signature, ok := buildInSignatures[functionCall.FunctionName]; ok {
+		if signature.arguments == nil {
+			for _, argument := range functionCall.Arguments {
+				checkValue(checked, argument)
+			}
+		} else {
+			checkArguments(checked, functionCall, signature.arguments)
+		}
+
+		return signature.returnType
+	}
+
+	if host, ok := checked.hosts[functionCall.FunctionName]; ok {
+		if host.signature.Arguments == nil {
+			for _, argument := range functionCall.Arguments {
+				checkValue(checked, argument)
+			}
+		} else {
+			checkArguments(checked, functionCall, host.signature.Arguments)
+		}
+
+		if host.signature.ReturnType == "" {
+			return typeVoid
+		}
+		return host.signature.ReturnType
+	}
+
+	checked.addError(functionCall.Pos, "Can't find "+functionCall.FunctionName+" function!")
+	for _, argument := range functionCall.Arguments {
+		checkExpression(checked, argument)
+	}
+
+	return typeAny
+}
+
+// checkValue checks expression which has to return value, like argument or element of literal
+func checkValue(checked *CheckedCode, expression *Expression) string {
+	valueType := checkExpression(checked, expression)
+	if valueType == typeVoid {
+		checked.addError(expression.Pos, "expression doesn't return any value!")
+		return typeAny
+	}
+
+	return valueType
+}
+
+func checkExpression(checked *CheckedCode, expression *Expression) string {
+	left := checkAndExpression(checked, expression.Left)
+
+	for _, opTerm := range expression.Right {
+		right := checkAndExpression(checked, opTerm.Term)
+		left = checkLogicalOperation(checked, opTerm.Pos, left, right)
+	}
+
+	return left
+}
+
+func checkAndExpression(checked *CheckedCode, expression *AndExpression) string {
+	left := checkCompareExpression(checked, expression.Left)
+
+	for _, opTerm := range expression.Right {
+		right := checkCompareExpression(checked, opTerm.Term)
+		left = checkLogicalOperation(checked, opTerm.Pos, left, right)
+	}
+
+	return left
+}
+
+func checkLogicalOperation(checked *CheckedCode, pos lexer.Position, left string, right string) string {
+	for _, operandType := range []string{left, right} {
+		if operandType != "bool" && operandType != typeAny {
+			checked.addError(pos, "Logical operator needs bool operands!")
+			break
+		}
+	}
+
+	return "bool"
+}
+
+func checkCompareExpression(checked *CheckedCode, expression *CompareExpression) string {
+	left := checkComTerm(checked, expression.Left)
+
+	for _, opTerm := range expression.Right {
+		right := checkComTerm(checked, opTerm.Term)
+		left = checkCompareOperation(checked, opTerm.Pos, opTerm.Operator, left, right)
+	}
+
+	return left
+}
+
+func isNumericType(name string) bool {
+	return name == "int" || name == "float"
+}
+
+func checkCompareOperation(checked *CheckedCode, pos lexer.Position, operator string, left string, right string) string {
+	if left == typeAny || right == typeAny {
+		return "bool"
+	}
+
+	if isNumericType(left) && isNumericType(right) {
+		return "bool"
+	}
+
+	if left == "string" && right == "string" {
+		return "bool"
+	}
+
+	if left == "bool" && right == "bool" && (operator == "==" || operator == "!=") {
+		return "bool"
+	}
+
+	checked.addError(pos, "can't compare "+left+" and "+right+" with "+operator+"!")
+	return "bool"
+}
+
+func checkComTerm(checked *CheckedCode, comTerm *ComTerm) string {
+	left := checkTerm(checked, comTerm.Left)
+
+	for _, opTerm := range comTerm.Right {
+		right := checkTerm(checked, opTerm.Term)
+		left = checkMathOperation(checked, opTerm.Pos, opTerm.Operator, left, right)
+	}
+
+	return left
+}
+
+func checkTerm(checked *CheckedCode, term *Term) string {
+	left := checkFactor(checked, term.Left)
+
+	for _, opFactor := range term.Right {
+		right := checkFactor(checked, opFactor.Factor)
+		left = checkMathOperation(checked, opFactor.Pos, opFactor.Operator, left, right)
+	}
+
+	return left
+}
+
+func checkMathOperation(checked *CheckedCode, pos lexer.Position, operator string, left string, right string) string {
+	if left == "int" && right == "int" {
+		return "int"
+	}
+
+	if isNumericType(left) && isNumericType(right) {
+		return "float"
+	}
+
+	if operator == "+" && left == "string" && right == "string" {
+		return "string"
+	}
+
+	isOperand := func(name string) bool {
+		return isNumericType(name) || name == typeAny || (operator == "+" && name == "string")
+	}
+
+	if (left == typeAny || right == typeAny) && isOperand(left) && isOperand(right) {
+		return typeAny
+	}
+
+	checked.addError(pos, "Can't perform math operation "+operator+" on "+left+" and "+right+"!")
+	return typeAny
+}
+
+func checkFactor(checked *CheckedCode, factor *Factor) string {
+	if factor.Value != nil {
+		if factor.Value.Float != nil {
+			return "float"
+		} else if factor.Value.Integer != nil {
+			return "int"
+		} else if factor.Value.String != nil {
+			return "string"
+		} else if factor.Value.Boolean != nil {
+			return "bool"
+		}
+	}
+	if factor.FunctionCall != nil {
+		return checkFunctionCall(checked, factor.FunctionCall)
+	}
+	if factor.FieldCall != nil {
+		return checkFieldPath(checked, factor.Pos, factor.FieldCall.Name, factor.FieldCall.Fields)
+	}
+	if factor.Variable != nil {
+		varType, declared := checked.getVariableType(factor.Variable.Value)
+		if !declared {
+			checked.addError(factor.Pos, "Undeclared variable: "+factor.Variable.Value)
+			return typeAny
+		}
+		return varType
+	}
+	if factor.Subexpression != nil {
+		return checkExpression(checked, factor.Subexpression)
+	}
+	if factor.ArrayCall != nil {
+		return checkArrayCall(checked, factor.ArrayCall)
+	}
+	if factor.ArrayLiteral != nil {
+		for _, element := range factor.ArrayLiteral.Elements {
+			checkValue(checked, element)
+		}
+		return "array"
+	}
+	if factor.MapLiteral != nil {
+		for _, element := range factor.MapLiteral.Elements {
+			checkMapKey(checked, element.Key)
+			checkValue(checked, element.Value)
+		}
+		return "map"
+	}
+	if factor.Not != nil {
+		valueType := checkFactor(checked, factor.Not)
+		if valueType != "bool" && valueType != typeAny {
+			checked.addError(factor.Pos, "Operator ! needs bool operand!")
+		}
+		return "bool"
+	}
+	if factor.Negative != nil {
+		valueType := checkFactor(checked, factor.Negative)
+		if !isNumericType(valueType) && valueType != typeAny {
+			checked.addError(factor.Pos, "Can't perform math operation - on "+valueType+"!")
+			return typeAny
+		}
+		return valueType
+	}
+
+	return typeAny
+}
+
+func checkArrayCall(checked *CheckedCode, arrayCall *ArrayCall) string {
+	varType, declared := checked.getVariableType(arrayCall.Name)
+	if !declared {
+		checked.addError(arrayCall.Pos, "Undeclared variable: "+arrayCall.Name)
+		checkExpression(checked, arrayCall.Index)
+		return typeAny
+	}
+
+	switch varType {
+	case "array", "string":
+		indexType := checkExpression(checked, arrayCall.Index)
+		if indexType != "int" && indexType != typeAny {
+			checked.addError(arrayCall.Index.Pos, "Index is not integer!")
+		}
+
+		if varType == "string" {
+			return "string"
+		}
+		return typeAny
+	case "map":
+		checkMapKey(checked, arrayCall.Index)
+		return typeAny
+	case typeAny:
+		checkExpression(checked, arrayCall.Index)
+		return typeAny
+	}
+
+	checked.addError(arrayCall.Pos, "variable "+arrayCall.Name+" is not array!")
+	return typeAny
+}
@@ -0,0 +1,105 @@
+package karboscript
+
+import (
+	"strings"
+
+	"github.com/alecthomas/participle/v2"
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Diagnostic is single problem found in the code while parsing or compiling it
+type Diagnostic struct {
+	Severity string
+	File     string
+	Line     int
+	Column   int
+	Message  string
+}
+
+func newDiagnostic(pos lexer.Position, message string) *Diagnostic {
+	return &Diagnostic{SeverityError, pos.Filename, pos.Line, pos.Column, message}
+}
+
+func (diagnostic *Diagnostic) Position() lexer.Position {
+	return lexer.Position{Filename: diagnostic.File, Line: diagnostic.Line, Column: diagnostic.Column}
+}
+
+func (diagnostic *Diagnostic) Error() string {
+	return diagnostic.Position().String() + ": " + diagnostic.Message
+}
+
+type Diagnostics []*Diagnostic
+
+func (diagnostics Diagnostics) Error() string {
+	messages := make([]string, len(diagnostics))
+
+	for i, diagnostic := range diagnostics {
+		messages[i] = diagnostic.Error()
+	}
+
+	return strings.Join(messages, "\n")
+}
+
+func (diagnostics Diagnostics) HasErrors() bool {
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Severity == SeverityError {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetDiagnostics converts error returned by Parse, ParseString or GetOpcodes to list of diagnostics
+func GetDiagnostics(err error) Diagnostics {
+	switch err := err.(type) {
+	case nil:
+		return Diagnostics{}
+	case Diagnostics:
+		return err
+	case *Diagnostic:
+		return Diagnostics{err}
+	case participle.Error:
+		return Diagnostics{newDiagnostic(err.Position(), err.Message())}
+	}
+
+	return Diagnostics{&Diagnostic{SeverityError, "", 0, 0, err.Error()}}
+}
+
+// FormatDiagnostic returns diagnostic message followed by the line of source code it points to
+// and a caret under the column
+func FormatDiagnostic(diagnostic *Diagnostic, source string) string {
+	text := diagnostic.Position().String() + ": " + diagnostic.Severity + ": " + diagnostic.Message
+
+	lines := strings.Split(source, "\n")
+	if diagnostic.Line < 1 || diagnostic.Line > len(lines) {
+		return text
+	}
+
+	line := strings.TrimRight(lines[diagnostic.Line-1], "\r")
+	text = text + "\n    " + line
+
+	if diagnostic.Column < 1 {
+		return text
+	}
+
+	caret := []rune{}
+	for i, character := range []rune(line) {
+		if i >= diagnostic.Column-1 {
+			break
+		}
+
+		if character == '\t' {
+			caret = append(caret, '\t')
+		} else {
+			caret = append(caret, ' ')
+		}
+	}
+
+	return text + "\n    " + string(caret) + "^"
+}
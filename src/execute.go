@@ -1,160 +1,305 @@
 package karboscript
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"math"
+	"os"
 )
 
-type Call struct {
+// Frame is single function call, the first frame belongs to the code of global variables
+type Frame struct {
 	returnPointer int
 	returnType    *VarType
+	functionName  string
+	callPosition  string
+	// base is height of the operand stack below arguments of the call, the stack is cut to it by return and drop
+	base int
+	// locals is index of the first variable of the function in Program.locals
+	locals int
 }
 
 type Program struct {
 	Opcodes               []*Opcode
-	codePointer           *int
-	running               *bool
-	callstack             []Call
-	functionArgsStack     []any
-	functionArgumentCount *int
-	scopes                []*Scope
-	lastSubScope          *Scope
+	codePointer           int
+	running               bool
+	frames                []Frame
+	stack                 []Value
+	locals                []Var
+	globals               []Var
+	functionArgumentCount int
+	context               context.Context
+	stdin                 *Input
+	stdout                io.Writer
+	stderr                io.Writer
+	hostFunctions         map[string]hostFunction
 }
 
 type Var struct {
-	value   any
+	value   Value
 	varType VarType
 }
 
-type Scope struct {
-	expresionStack []any
-	variable       map[string]*Var
-	isFinal        bool
+func (program *Program) push(value Value) {
+	program.stack = append(program.stack, value)
 }
 
-func (program *Program) getScope(depth int) *Scope {
-	x := len(program.scopes) - 1 - depth
-	return program.scopes[x]
-}
-
-func (scope *Scope) popExp() (any, error) {
-	x := len(scope.expresionStack) - 1
+func (program *Program) pop() (Value, error) {
+	x := len(program.stack) - 1
 
 	if x < 0 {
-		return 0, errors.New("No value on expresion stack!")
+		return Value{}, errors.New("No value on expresion stack!")
 	}
 
-	value := scope.expresionStack[x]
+	value := program.stack[x]
 
-	scope.expresionStack = scope.expresionStack[0:x]
+	program.stack = program.stack[0:x]
 	return value, nil
 }
 
-func (scope *Scope) pushExp(value any) {
-	scope.expresionStack = append(scope.expresionStack, value)
+func (program *Program) peek() (Value, error) {
+	x := len(program.stack) - 1
+
+	if x < 0 {
+		return Value{}, errors.New("No value on expresion stack!")
+	}
+
+	return program.stack[x], nil
 }
 
-func (program *Program) addScope() {
-	program.scopes = append(program.scopes, &Scope{
-		expresionStack: []any{},
-		variable:       map[string]*Var{},
-		isFinal:        false,
-	})
+func (program *Program) frame() *Frame {
+	return &program.frames[len(program.frames)-1]
 }
 
-func (program *Program) subScope() *Scope {
-	x := len(program.scopes) - 1
+// variable returns declared variable in the slot, local variable hides global one
+func (program *Program) variable(slot Slot) *Var {
+	if slot.Local >= 0 {
+		index := program.frame().locals + slot.Local
+		if index < len(program.locals) && program.locals[index].varType.Value != "" {
+			return &program.locals[index]
+		}
+	}
 
-	value := program.scopes[x]
+	if slot.Global >= 0 && slot.Global < len(program.globals) && program.globals[slot.Global].varType.Value != "" {
+		return &program.globals[slot.Global]
+	}
 
-	program.scopes = program.scopes[0:x]
-	return value
+	return nil
 }
 
-func (program *Program) getVariable(name string) *Var {
-	meetFinal := false
-	for i := 0; i < len(program.scopes)-1; i++ {
-		if meetFinal {
+// declare returns variable which is set by declaration, function declares variables in its local slots
+func (program *Program) declare(slot Slot) *Var {
+	if slot.Local >= 0 {
+		index := program.frame().locals + slot.Local
+		if index >= len(program.locals) {
 			return nil
 		}
 
-		if program.getScope(i).isFinal {
-			meetFinal = true
-		}
+		return &program.locals[index]
+	}
 
-		if _, ok := program.getScope(i).variable[name]; ok {
-			return program.getScope(i).variable[name]
-		}
+	if slot.Global < 0 {
+		return nil
+	}
+
+	for len(program.globals) <= slot.Global {
+		program.globals = append(program.globals, Var{})
+	}
+
+	return &program.globals[slot.Global]
+}
+
+// setLoopVariable sets variable used by loop, its type is taken from the value
+func (program *Program) setLoopVariable(slot Slot, name string, value Value) error {
+	variable := program.declare(slot)
+	if variable == nil {
+		return errors.New("Broken variable: " + name)
 	}
 
+	*variable = Var{value, VarType{value.TypeName()}}
 	return nil
 }
 
-func (program *Program) getVariableScopePosition(name string) int {
-	meetFinal := false
-	for i := 0; i < len(program.scopes)-1; i++ {
-		if meetFinal {
-			return -1
-		}
+// returnFromFunction removes variables and values of the current function and continues after its call
+func (program *Program) returnFromFunction() error {
+	if len(program.frames) < 2 {
+		return errors.New("return used outside of function!")
+	}
 
-		if program.getScope(i).isFinal {
-			meetFinal = true
-		}
+	frame := program.frame()
 
-		if _, ok := program.getScope(i).variable[name]; ok {
-			return i
-		}
+	for i := frame.locals; i < len(program.locals); i++ {
+		program.locals[i] = Var{}
 	}
+	program.locals = program.locals[0:frame.locals]
+	program.stack = program.stack[0:frame.base]
+	program.codePointer = frame.returnPointer
 
-	return -1
+	program.frames = program.frames[0 : len(program.frames)-1]
+	return nil
+}
+
+// ExecuteOptions configures how the script is executed
+type ExecuteOptions struct {
+	// MaxSteps is maximum number of executed opcodes, 0 means no limit
+	MaxSteps int
+	// Context stops the script when it's cancelled, nil means context.Background()
+	Context context.Context
+	// Stdin is read by readLine and readInt, nil means os.Stdin. Input which the run buffered
+	// but didn't read is lost when it ends, use Input to keep it for the next run.
+	Stdin io.Reader
+	// Input is read by readLine and readInt instead of Stdin, runs which get the same Input
+	// share its buffer
+	Input *Input
+	// Stdout is written by out, nil means os.Stdout
+	Stdout io.Writer
+	// Stderr is written by outErr, nil means os.Stderr
+	Stderr io.Writer
 }
 
+// contextCheckInterval is number of opcodes executed between checks of context cancellation
+const contextCheckInterval = 1000
+
+// ErrStepBudgetExceeded is returned (wrapped in RuntimeError) when script executes more opcodes than ExecuteOptions.MaxSteps allows
+var ErrStepBudgetExceeded = errors.New("Step budget exceeded!")
+
 func Execute(stack *[]*Opcode) error {
-	killSwitch := 100000
-	codePointer := len(*stack) - 2
-	running := true
-	callstack := []Call{}
-	functionArgumentCount := 0
+	return ExecuteWithOptions(stack, ExecuteOptions{})
+}
 
-	program := Program{
-		*stack, &codePointer, &running, callstack, []any{}, &functionArgumentCount, []*Scope{}, nil,
+// ExecuteContext executes the script until it ends or ctx is cancelled
+func ExecuteContext(ctx context.Context, stack *[]*Opcode) error {
+	return ExecuteWithOptions(stack, ExecuteOptions{Context: ctx})
+}
+
+func ExecuteWithOptions(stack *[]*Opcode, options ExecuteOptions) error {
+	_, err := run(stack, options, nil)
+	return err
+}
+
+// run executes opcodes from the start label and returns the program in state in which it stopped
+func run(stack *[]*Opcode, options ExecuteOptions, hostFunctions map[string]hostFunction) (*Program, error) {
+	if len(*stack) == 0 {
+		return nil, errors.New("Nothing to execute!")
+	}
+
+	start := len(*stack) - 2
+	for i, opcode := range *stack {
+		if opcode.Label != nil && *opcode.Label == startLabel {
+			start = i
+			break
+		}
+	}
+
+	return runFrom(stack, start, nil, options, hostFunctions)
+}
+
+// runFrom executes opcodes from the start index with given global variables
+func runFrom(stack *[]*Opcode, start int, globals []Var, options ExecuteOptions, hostFunctions map[string]hostFunction) (*Program, error) {
+	if len(*stack) == 0 {
+		return nil, errors.New("Nothing to execute!")
+	}
+
+	ctx := options.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	stdin := options.Input
+	if stdin == nil && options.Stdin != nil {
+		stdin = NewInput(options.Stdin)
+	}
+	if stdin == nil {
+		stdin = stdinInput()
+	}
+	var stdout io.Writer = os.Stdout
+	if options.Stdout != nil {
+		stdout = options.Stdout
+	}
+	var stderr io.Writer = os.Stderr
+	if options.Stderr != nil {
+		stderr = options.Stderr
+	}
+
+	// opcodes made by hand don't have to know slots of their variables
+	for _, opcode := range *stack {
+		if opcode.Slots == nil && len(opcode.variables()) > 0 {
+			if err := resolveSlots(*stack); err != nil {
+				return nil, err
+			}
+			break
+		}
 	}
-	program.addScope()
 
-	for *program.running {
-		killSwitch--
+	steps := 0
 
-		if killSwitch < 0 {
-			running = false
+	program := Program{
+		Opcodes:       *stack,
+		codePointer:   start,
+		running:       true,
+		frames:        []Frame{{}},
+		stack:         []Value{},
+		globals:       globals,
+		context:       ctx,
+		stdin:         stdin,
+		stdout:        stdout,
+		stderr:        stderr,
+		hostFunctions: hostFunctions,
+	}
+
+	for program.running {
+		if options.MaxSteps > 0 && steps >= options.MaxSteps {
+			return &program, newRuntimeError(&program, program.currentOpcode(), ErrStepBudgetExceeded)
+		}
+		if steps%contextCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return &program, newRuntimeError(&program, program.currentOpcode(), err)
+			}
 		}
+		steps++
 
 		err := executeOpcode(&program)
 		if err != nil {
-			opcode := program.Opcodes[*program.codePointer-1]
+			opcode := program.Opcodes[program.codePointer-1]
 
-			return errors.New(opcode.Position + ": " + err.Error())
+			return &program, newRuntimeError(&program, opcode, err)
 		}
 	}
 
-	return nil
+	return &program, nil
+}
+
+// currentOpcode returns last executed opcode
+func (program *Program) currentOpcode() *Opcode {
+	x := program.codePointer - 1
+
+	if x < 0 {
+		x = 0
+	}
+	if x >= len(program.Opcodes) {
+		x = len(program.Opcodes) - 1
+	}
+
+	return program.Opcodes[x]
 }
 
 func getNextOpcode(program *Program) (*Opcode, error) {
-	*program.codePointer++
+	program.codePointer++
 
-	if *program.codePointer > len((*program).Opcodes) {
+	if program.codePointer > len((*program).Opcodes) {
 		return nil, nil
 	}
 
-	return program.Opcodes[*program.codePointer-1], nil
+	return program.Opcodes[program.codePointer-1], nil
 }
 
 func executeOpcode(program *Program) error {
 	opcode, err := getNextOpcode(program)
 
-	//fmt.Println(opcode)
-
 	if opcode == nil {
+		program.running = false
 		return nil
 	}
 
@@ -162,566 +307,564 @@ func executeOpcode(program *Program) error {
 		return err
 	}
 
-	if opcode.Operation == "exit" {
-		*program.running = false
-		return nil
-	}
+	switch opcode.Operation {
+	case OpExit:
+		program.running = false
 
-	if opcode.Operation == "push_exp" {
-		program.getScope(0).pushExp(opcode.Arguments[0])
-		return nil
-	}
+	case OpStart, OpIfElse, OpIfEnd, OpWhileStart, OpWhileElse, OpForStart, OpForContinue, OpForEnd, OpForincEnd:
+		// operations which only hold label
 
-	if opcode.Operation == "push_exp_var" {
-		if name, ok := opcode.Arguments[0].(string); ok {
-			x := program.getVariable(name)
-			if x == nil {
-				return errors.New("Undeclared variable: " + name)
-			}
-			program.getScope(0).pushExp(x.value)
+	case OpFunction:
+		for i := 0; i < opcode.Count; i++ {
+			program.locals = append(program.locals, Var{})
 		}
-		return nil
-	}
 
-	if opcode.Operation == "push_last_exp" {
-		x, error := (*program).lastSubScope.popExp()
-		if error != nil {
-			return error
+	case OpPushExp:
+		program.push(opcode.Value)
+
+	case OpPushExpVar:
+		x := program.variable(opcode.Slots[0])
+		if x == nil {
+			return errors.New("Undeclared variable: " + opcode.Name)
 		}
-		program.getScope(0).pushExp(x)
-	}
+		program.push(x.value)
 
-	if opcode.Operation == "push_empty_arr" {
-		program.getScope(0).pushExp([]any{})
-		return nil
-	}
+	case OpDrop:
+		program.stack = program.stack[0:program.frame().base]
 
-	if opcode.Operation == "push_arr_exp" {
-		newElement, error := (*program).lastSubScope.popExp()
-		if error != nil {
-			return error
-		}
+	case OpPushEmptyArr:
+		program.push(ArrayValue([]Value{}))
 
-		arr, err1 := program.getScope(0).popExp()
-		if err1 != nil {
-			return err1
+	case OpPushArrExp:
+		newElement, err := program.pop()
+		if err != nil {
+			return err
 		}
 
-		if arrayToAdd, ok := arr.([]any); ok {
-			program.getScope(0).pushExp(append(arrayToAdd, newElement))
+		arr, err := program.pop()
+		if err != nil {
+			return err
+		}
 
-			return nil
-		} else {
+		if arr.Kind() != KindArray {
 			return errors.New("variable is not array!")
 		}
-	}
 
-	if opcode.Operation == "add_arr_exp" {
-		newElement, error := (*program).lastSubScope.popExp()
-		if error != nil {
-			return error
-		}
+		program.push(ArrayValue(append(arr.Array(), newElement)))
 
-		if name, ok := opcode.Arguments[0].(string); ok {
-			x := program.getVariable(name)
-			if x == nil {
-				return errors.New("Undeclared variable: " + name)
-			}
-			
-			if arrayToAdd, ok := x.value.([]any); ok {
-				x.value = append(arrayToAdd, newElement)
-				return nil
-			} else {
-				return errors.New("variable is not array!")
-			}
-		}
-		return nil
+	case OpPushEmptyMap:
+		program.push(MapValue(newMap()))
 
-		arr, err1 := program.getScope(0).popExp()
-		if err1 != nil {
-			return err1
+	case OpPushMapExp:
+		value, err := program.pop()
+		if err != nil {
+			return err
 		}
 
-		if arrayToAdd, ok := arr.([]any); ok {
-			program.getScope(0).pushExp(append(arrayToAdd, newElement))
+		key, err := program.pop()
+		if err != nil {
+			return err
+		}
 
-			return nil
-		} else {
-			return errors.New("variable is not array!")
+		if err := validateMapKey(key); err != nil {
+			return err
 		}
-	}
 
-	if opcode.Operation == "push_arr_call" {
-		index, error := (*program).lastSubScope.popExp()
-		if error != nil {
-			return error
+		mapValue, err := program.peek()
+		if err != nil {
+			return err
 		}
 
-		arr := program.getVariable(opcode.Arguments[0].(string))
-		if arr == nil {
-			return errors.New("Undeclared variable: " + opcode.Arguments[0].(string))
+		mapToAdd := mapValue.Map()
+		if mapToAdd == nil {
+			return errors.New("variable is not map!")
 		}
 
-		if array, ok := arr.value.([]any); ok {
-			if index, ok := index.(int); ok {
-				if index >= len(array) {
-					return errors.New("Index out of range!")
-				}
+		mapToAdd.set(key, value)
 
-				program.getScope(0).pushExp(array[index])
-			} else {
-				return errors.New("Index is not integer!")
-			}
-		} else {
-			return errors.New("variable is not array!")
+	case OpPushNewStruct:
+		newStruct, err := newStructValue(opcode.Name, opcode.Names)
+		if err != nil {
+			return err
 		}
-	}
 
-	if opcode.Operation == "add_scope" {
-		program.addScope()
-		return nil
-	}
+		program.push(structValue(newStruct))
 
-	if opcode.Operation == "sub_scope" {
-		program.lastSubScope = program.subScope()
+	case OpSetStructFieldExp:
+		value, err := program.pop()
+		if err != nil {
+			return err
+		}
 
-		return nil
-	}
+		top, err := program.peek()
+		if err != nil {
+			return err
+		}
 
-	if opcode.Operation == "set_local_var_arg" {
-		if varName, ok := opcode.Arguments[0].(string); ok {
-			if name, ok := opcode.Arguments[1].(string); ok {
-				varScopePosition := program.getVariableScopePosition(name)
-				variable := Var{program.popFunctionArgument(), VarType{varName}}
+		structValue := top.Struct()
+		if structValue == nil {
+			return errors.New("variable is not struct!")
+		}
 
-				if err, ok := validateVariable(variable); !ok {
-					return err
-				}
+		return structValue.setField(opcode.Name, value)
 
-				if varScopePosition > -1 {
-					program.getScope(varScopePosition).variable[name] = &variable
-				} else {
-					program.getScope(0).variable[name] = &variable
-				}
-			}
+	case OpPushStructField:
+		structValue, err := getStructFromPath(program, opcode.Slots[0], opcode.Names[0:len(opcode.Names)-1])
+		if err != nil {
+			return err
 		}
 
-		return nil
-	}
+		value, err := structValue.getField(opcode.Names[len(opcode.Names)-1])
+		if err != nil {
+			return err
+		}
 
-	if opcode.Operation == "set_local_var_exp" {
+		program.push(value)
 
-		if name, ok := opcode.Arguments[1].(string); ok {
-			var varName = ""
+	case OpSetStructFieldVarExp:
+		value, err := program.pop()
+		if err != nil {
+			return err
+		}
 
-			if varTypeFromOpcode, ok := opcode.Arguments[0].(string); ok && varTypeFromOpcode != "" {
-				varName = varTypeFromOpcode
-			} else {
-				variableForType := program.getVariable(name)
+		structValue, err := getStructFromPath(program, opcode.Slots[0], opcode.Names[0:len(opcode.Names)-1])
+		if err != nil {
+			return err
+		}
 
-				if variableForType != nil {
-					varName = variableForType.varType.Value
-				} else {
-					return errors.New("Undeclared variable: " + name)
-				}
-			}
+		return structValue.setField(opcode.Names[len(opcode.Names)-1], value)
 
-			if varName == "" {
-				return errors.New("Broken variable: " + name)
-			}
+	case OpAddArrExp:
+		newElement, err := program.pop()
+		if err != nil {
+			return err
+		}
 
-			varScopePosition := program.getVariableScopePosition(name)
-			varValue, err := program.lastSubScope.popExp()
+		x := program.variable(opcode.Slots[0])
+		if x == nil {
+			return errors.New("Undeclared variable: " + opcode.Name)
+		}
 
-			if err != nil {
-				return err
-			}
+		if x.value.Kind() != KindArray {
+			return errors.New("variable is not array!")
+		}
 
-			variable := Var{varValue, VarType{varName}}
+		x.value = ArrayValue(append(x.value.Array(), newElement))
 
-			if err, ok := validateVariable(variable); !ok {
-				return err
-			}
+	case OpPushArrCall:
+		index, err := program.pop()
+		if err != nil {
+			return err
+		}
 
-			if varScopePosition > -1 {
+		return pushArrayElement(program, opcode, index)
 
-				program.getScope(varScopePosition).variable[name] = &variable
-			} else {
-				program.getScope(0).variable[name] = &variable
-			}
+	case OpPushArrCallPeek:
+		index, err := program.peek()
+		if err != nil {
+			return err
 		}
 
-		return nil
-	}
+		return pushArrayElement(program, opcode, index)
 
-	if opcode.Operation == "set_array_var_exp" {
+	case OpSetLocalVarArg:
+		argument, err := program.pop()
+		if err != nil {
+			return err
+		}
 
-		if name, ok := opcode.Arguments[0].(string); ok {
+		variable := Var{argument, VarType{opcode.Type}}
 
-			variableForType := program.getVariable(name)
+		if err, ok := validateVariable(variable); !ok {
+			return err
+		}
 
-			if variableForType == nil {
-				return errors.New("Undeclared variable: " + name)
-			}
+		slot := program.declare(opcode.Slots[0])
+		if slot == nil {
+			return errors.New("Broken variable: " + opcode.Name)
+		}
+		*slot = variable
 
-			expression, err := program.getScope(0).popExp()
+	case OpSetLocalVarExp:
+		name := opcode.Name
+		varName := opcode.Type
+		var slot *Var
 
-			if err != nil {
-				return err
+		if varName != "" {
+			// declaration creates local variable even when global with the same name exists
+			slot = program.declare(opcode.Slots[0])
+		} else {
+			slot = program.variable(opcode.Slots[0])
+			if slot == nil {
+				return errors.New("Undeclared variable: " + name)
 			}
 
-			index, err := program.getScope(0).popExp()
+			varName = slot.varType.Value
+		}
 
-			if err != nil {
-				return err
-			}
+		if varName == "" || slot == nil {
+			return errors.New("Broken variable: " + name)
+		}
 
-			variable := program.getVariable(name)
+		varValue, err := program.pop()
+		if err != nil {
+			return err
+		}
 
-			if variable, err := variable.value.([]any); err {
-				if index, ok := index.(int); ok {
-					if index >= len(variable) {
-						return errors.New("Index out of range!")
-					}
+		variable := Var{varValue, VarType{varName}}
 
-					variable[index] = expression
-				} else {
-					return errors.New("Index is not integer!")
-				}
-			} else {
-				return errors.New("variable is not array!")
-			}
+		if err, ok := validateVariable(variable); !ok {
+			return err
 		}
 
-		return nil
-	}
+		*slot = variable
 
-	if opcode.Operation == "push_bellow" {
-		value, err := program.lastSubScope.popExp()
+	case OpSetArrayVarExp:
+		variable := program.variable(opcode.Slots[0])
+		if variable == nil {
+			return errors.New("Undeclared variable: " + opcode.Name)
+		}
+
+		expression, err := program.pop()
 		if err != nil {
 			return err
 		}
 
-		newCodePointer := program.callstack[len(program.callstack)-1]
+		index, err := program.pop()
+		if err != nil {
+			return err
+		}
 
-		if newCodePointer.returnType != nil {
-			if err, ok := validateReturnType(newCodePointer, value); !ok {
+		if mapValue := variable.value.Map(); mapValue != nil {
+			if err := validateMapKey(index); err != nil {
 				return err
 			}
+
+			mapValue.set(index, expression)
+			return nil
 		}
 
-		program.getScope(1).pushExp(value)
-		return nil
-	}
+		if variable.value.Kind() != KindArray {
+			return errors.New("variable is not array!")
+		}
+		if index.Kind() != KindInt {
+			return errors.New("Index is not integer!")
+		}
 
-	if opcode.Operation == "exp_call" {
-		error := mathOperation(program, opcode)
-		if error != nil {
-			return error
+		array := variable.value.Array()
+		if index.Int() < 0 || index.Int() >= len(array) {
+			return errors.New("Index out of range!")
 		}
 
-		return nil
-	}
+		array[index.Int()] = expression
+
+	case OpExpCall:
+		return mathOperation(program, opcode)
 
-	if opcode.Operation == "if" {
-		lastVal, err := program.lastSubScope.popExp()
+	case OpIf, OpWhile, OpFor:
+		lastVal, err := program.pop()
 		if err != nil {
 			return err
 		}
 
-		if val, ok := lastVal.(bool); ok {
-			if label, ok := opcode.Arguments[0].(string); ok {
-				if !val {
-					*program.codePointer, err = findLabel(program, label)
-				}
-				if err != nil {
-					return err
-				}
-			}
-		} else {
+		if lastVal.Kind() != KindBool {
 			return errors.New("Condition must return bool")
 		}
-		return nil
-	}
-	if opcode.Operation == "jmp" {
 
-		if label, ok := opcode.Arguments[0].(string); ok {
-			*program.codePointer, err = findLabel(program, label)
+		if !lastVal.Bool() {
+			return jumpTo(program, opcode.Jump)
+		}
 
-			if err != nil {
-				return err
-			}
+	case OpAnd, OpOr:
+		lastVal, err := program.pop()
+		if err != nil {
+			return err
 		}
 
-		return nil
-	}
+		if lastVal.Kind() != KindBool {
+			return errors.New("Logical operator needs bool operands!")
+		}
+
+		if lastVal.Bool() == (opcode.Operation == OpOr) {
+			program.push(lastVal)
 
-	if opcode.Operation == "while" || opcode.Operation == "for" {
-		lastVal, err := program.lastSubScope.popExp()
+			return jumpTo(program, opcode.Jump)
+		}
+
+	case OpLogicEnd:
+		lastVal, err := program.peek()
 		if err != nil {
 			return err
 		}
 
-		if val, ok := lastVal.(bool); ok {
-			if label, ok := opcode.Arguments[0].(string); ok {
-				if !val {
-					*program.codePointer, err = findLabel(program, label)
-					if err != nil {
-						return err
-					}
-				}
-			}
-		} else {
-			return errors.New("Condition must return bool")
+		if lastVal.Kind() != KindBool {
+			return errors.New("Logical operator needs bool operands!")
 		}
-		return nil
-	}
 
-	if opcode.Operation == "forinc_start" {
-		if variable, ok := opcode.Arguments[0].(string); ok {
-			val := program.getVariable(variable)
+	case OpJmp:
+		return jumpTo(program, opcode.Jump)
 
-			if val == nil {
-				return errors.New("forint use uninitalized variable!")
-			}
+	case OpForincStart, OpForinc:
+		val := program.variable(opcode.Slots[0])
+		valEnd := program.variable(opcode.Slots[1])
 
-			valEnd := program.getVariable(variable + "_end")
+		if val == nil || valEnd == nil {
+			return errors.New("forint use uninitalized variable!")
+		}
 
-			if val == nil {
-				return errors.New("forint use uninitalized variable!")
-			}
-			if a, ok := val.value.(int); ok {
-				if b, ok := valEnd.value.(int); ok {
-					if a == b {
-						if label, ok := opcode.Arguments[1].(string); ok {
-							*program.codePointer, err = findLabel(program, label)
-							if err != nil {
-								return err
-							}
-						}
-					}
-				}
+		if val.value.Kind() != KindInt || valEnd.value.Kind() != KindInt {
+			if opcode.Operation == OpForincStart {
+				return nil
 			}
+			return jumpTo(program, opcode.Jump)
+		}
+
+		a, b := val.value.Int(), valEnd.value.Int()
 
+		if opcode.Operation == OpForincStart {
+			if a == b {
+				return jumpTo(program, opcode.Jump)
+			}
 			return nil
-		} else {
-			return errors.New("??")
 		}
-	}
 
-	if opcode.Operation == "forinc" {
-		if variable, ok := opcode.Arguments[0].(string); ok {
-			val := program.getVariable(variable)
+		if a < b {
+			val.value = IntValue(a + 1)
+		}
+		if a > b {
+			val.value = IntValue(a - 1)
+		}
 
-			if val == nil {
-				return errors.New("forint use uninitalized variable!")
-			}
+		return jumpTo(program, opcode.Jump)
 
-			valEnd := program.getVariable(variable + "_end")
+	case OpForeachInit:
+		collection, err := program.pop()
+		if err != nil {
+			return err
+		}
 
-			if val == nil {
-				return errors.New("forint use uninitalized variable!")
-			}
+		iterator, err := newForeachIterator(collection)
+		if err != nil {
+			return err
+		}
 
-			if a, ok := val.value.(int); ok {
-				if b, ok := valEnd.value.(int); ok {
-					if a < b {
-						val.value = a + 1
-					}
-					if a > b {
-						val.value = a - 1
-					}
-				}
-			}
+		return program.setLoopVariable(opcode.Slots[0], opcode.Name, iteratorValue(iterator))
 
-			if label, ok := opcode.Arguments[1].(string); ok {
-				*program.codePointer, err = findLabel(program, label)
-				if err != nil {
-					return err
-				}
+	case OpForeachNext:
+		variable := program.variable(opcode.Slots[0])
+		if variable == nil || variable.value.iterator() == nil {
+			return errors.New("foreach use uninitalized iterator!")
+		}
+
+		key, value, ok := variable.value.iterator().next()
+		if !ok {
+			return jumpTo(program, opcode.Jump)
+		}
+
+		if opcode.Names[0] != "" {
+			if err := program.setLoopVariable(opcode.Slots[1], opcode.Names[0], key); err != nil {
+				return err
 			}
+		}
+		return program.setLoopVariable(opcode.Slots[2], opcode.Names[1], value)
 
-			return nil
-		} else {
-			return errors.New("??")
+	case OpForeachEnd:
+		if variable := program.variable(opcode.Slots[0]); variable != nil {
+			*variable = Var{}
 		}
-	}
 
-	if opcode.Operation == "call_function" {
-		if functionName, ok := opcode.Arguments[0].(string); ok {
-			if val, ok := buildInFunctions[functionName]; ok {
-				if count, ok := opcode.Arguments[1].(int); ok {
-					*program.functionArgumentCount = count
-				} else {
-					return errors.New("call_function needs to have number of arguments as second parameter")
-				}
+	case OpCallFunction:
+		program.functionArgumentCount = opcode.Count
 
-				err := val(program)
-				if err != nil {
-					return err
-				}
-				return nil
-			}
+		if buildIn, ok := buildInFunctions[opcode.Name]; ok {
+			return buildIn(program)
+		}
 
-			if count, ok := opcode.Arguments[1].(int); ok {
-				*program.functionArgumentCount = count
-			} else {
-				return errors.New("call_function needs to have number of arguments as second parameter")
-			}
+		if host, ok := program.hostFunctions[opcode.Name]; ok {
+			return callHostFunction(program, opcode.Name, host)
+		}
 
-			var returnType *VarType
+		var returnType *VarType
+		if opcode.Type != "" {
+			returnType = &VarType{opcode.Type}
+		}
 
-			if len(opcode.Arguments) == 3 {
-				if varType, ok := opcode.Arguments[2].(string); ok {
-					returnType = &VarType{varType}
-				}
-			}
+		base := len(program.stack) - opcode.Count
+		if base < 0 {
+			return errors.New("No value on expresion stack!")
+		}
 
-			program.callstack = append(program.callstack, Call{*program.codePointer, returnType})
-			*program.codePointer, err = findLabel(program, "_function."+functionName)
-			program.addScope()
-			program.getScope(0).isFinal = true
-			if err != nil {
-				return err
-			}
-			return nil
-		} else {
-			return errors.New("call_function opcode has wrong argument")
+		program.frames = append(program.frames, Frame{program.codePointer, returnType, opcode.Name, opcode.Position, base, len(program.locals)})
+
+		return jumpTo(program, opcode.Jump)
+
+	case OpReturnValue:
+		value, err := program.pop()
+		if err != nil {
+			return err
 		}
 
-	}
+		if err, ok := validateReturnType(*program.frame(), value); !ok {
+			return err
+		}
 
-	if opcode.Operation == "push_function_arg" {
-		x, error := (*program).lastSubScope.popExp()
-		if error != nil {
-			return error
+		if err := program.returnFromFunction(); err != nil {
+			return err
 		}
-		program.functionArgsStack = append(program.functionArgsStack, x)
-	}
 
-	if opcode.Operation == "function_return" {
-		program.subScope()
-		//todo clear functions args from stack
+		program.push(value)
+
+	case OpFunctionReturn:
+		return program.returnFromFunction()
 
-		newCodePointer := program.callstack[len(program.callstack)-1]
-		program.callstack = program.callstack[0 : len(program.callstack)-1]
-		*program.codePointer = newCodePointer.returnPointer
+	default:
+		return errors.New("Unknown operation " + opcode.Operation.String() + "!")
 	}
 
 	return nil
 }
 
-func validateReturnType(newCodePointer Call, value any) (error, bool) {
-
-	if newCodePointer.returnType == nil {
-		return nil, true
+// pushArrayElement pushes element of array, character of string or value of map stored in variable
+func pushArrayElement(program *Program, opcode *Opcode, index Value) error {
+	arr := program.variable(opcode.Slots[0])
+	if arr == nil {
+		return errors.New("Undeclared variable: " + opcode.Name)
 	}
 
-	if newCodePointer.returnType.Value == "string" {
-		if _, ok := value.(string); ok {
-			return nil, true
-		} else {
-			return errors.New("return value is not string!"), false
+	switch arr.value.Kind() {
+	case KindArray:
+		if index.Kind() != KindInt {
+			return errors.New("Index is not integer!")
 		}
-	}
-	if newCodePointer.returnType.Value == "int" {
-		if _, ok := value.(int); ok {
-			return nil, true
-		} else {
-			return errors.New("return value is not int!"), false
+
+		array := arr.value.Array()
+		if index.Int() < 0 || index.Int() >= len(array) {
+			return errors.New("Index out of range!")
 		}
-	}
-	if newCodePointer.returnType.Value == "bool" {
-		if _, ok := value.(bool); ok {
-			return nil, true
-		} else {
-			return errors.New("return value is not bool!"), false
+
+		program.push(array[index.Int()])
+
+	case KindString:
+		if index.Kind() != KindInt {
+			return errors.New("Index is not integer!")
 		}
-	}
-	if newCodePointer.returnType.Value == "float" {
-		if _, ok := value.(float64); ok {
-			return nil, true
-		} else {
-			return errors.New("return value is not float!"), false
+
+		characters := []rune(arr.value.String())
+		if index.Int() < 0 || index.Int() >= len(characters) {
+			return errors.New("Index out of range!")
 		}
-	}
-	if newCodePointer.returnType.Value == "array" {
-		if _, ok := value.([]any); ok {
-			return nil, true
-		} else {
-			return errors.New("return value is not array!"), false
+
+		program.push(StringValue(string(characters[index.Int()])))
+
+	case KindMap:
+		value, ok := arr.value.Map().get(index)
+		if !ok {
+			return fmt.Errorf("Key %v not found in map!", index)
 		}
+
+		program.push(value)
+
+	default:
+		return errors.New("variable is not array!")
 	}
 
-	return errors.New("cant validate return value!"), false
+	return nil
 }
 
-func validateVariable(variable Var) (error, bool) {
-	if variable.varType.Value == "string" {
-		if _, ok := variable.value.(string); ok {
-			return nil, true
-		} else {
-			return errors.New("variable is not string!"), false
-		}
-	}
-	if variable.varType.Value == "int" {
-		if _, ok := variable.value.(int); ok {
-			return nil, true
-		} else {
-			return errors.New("variable is not int!"), false
-		}
-	}
-	if variable.varType.Value == "bool" {
-		if _, ok := variable.value.(bool); ok {
-			return nil, true
-		} else {
-			return errors.New("variable is not bool!"), false
-		}
+func validateReturnType(frame Frame, value Value) (error, bool) {
+	if frame.returnType == nil {
+		return nil, true
 	}
-	if variable.varType.Value == "float" {
-		if _, ok := variable.value.(float64); ok {
-			return nil, true
-		} else {
-			return errors.New("variable is not float!"), false
-		}
+
+	if value.TypeName() != frame.returnType.Value {
+		return errors.New("return value is not " + frame.returnType.Value + "!"), false
 	}
-	if variable.varType.Value == "array" {
-		if _, ok := variable.value.([]any); ok {
-			return nil, true
-		} else {
-			return errors.New("variable is not array!"), false
-		}
+
+	return nil, true
+}
+
+func validateVariable(variable Var) (error, bool) {
+	if variable.value.TypeName() != variable.varType.Value {
+		return errors.New("variable is not " + variable.varType.Value + "!"), false
 	}
 
-	return errors.New("cant validate variable!"), false
+	return nil, true
 }
 
 func mathOperation(program *Program, opcode *Opcode) error {
-	operation := fmt.Sprintf("%v", opcode.Arguments[0])
+	operator := opcode.Operator
 
-	if operation == "*" || operation == "/" || operation == "+" || operation == "-" {
-		val1, err1 := program.getScope(0).popExp()
+	if operator == OperatorNot {
+		val, err := program.pop()
+		if err != nil {
+			return err
+		}
+		if val.Kind() == KindBool {
+			program.push(BoolValue(!val.Bool()))
+			return nil
+		}
+
+		return errors.New("Operator ! needs bool operand!")
+	}
+
+	if operator >= OperatorAdd && operator <= OperatorMod {
+		val1, err1 := program.pop()
 		if err1 != nil {
 			return err1
 		}
-		val2, err2 := program.getScope(0).popExp()
+		val2, err2 := program.pop()
 		if err2 != nil {
 			return err2
 		}
-		if val1, ok := val1.(int); ok {
-			if val2, ok := val2.(int); ok {
-				switch operation {
-				case "*":
-					program.getScope(0).pushExp(val2 * val1)
-				case "/":
-					if val1 == 0 {
+		if val1.Kind() == KindInt && val2.Kind() == KindInt {
+			a, b := val2.Int(), val1.Int()
+			switch operator {
+			case OperatorMul:
+				program.push(IntValue(a * b))
+			case OperatorDiv:
+				if b == 0 {
+					return errors.New("Division by 0!")
+				}
+				program.push(IntValue(a / b))
+			case OperatorMod:
+				if b == 0 {
+					return errors.New("Division by 0!")
+				}
+				program.push(IntValue(a % b))
+			case OperatorAdd:
+				program.push(IntValue(a + b))
+			case OperatorSub:
+				program.push(IntValue(a - b))
+			}
+
+			return nil
+		}
+
+		if val1.Kind() == KindString && val2.Kind() == KindString && operator == OperatorAdd {
+			program.push(StringValue(val2.String() + val1.String()))
+
+			return nil
+		}
+
+		if b, ok := val1.toFloat(); ok {
+			if a, ok := val2.toFloat(); ok {
+				switch operator {
+				case OperatorMul:
+					program.push(FloatValue(a * b))
+				case OperatorDiv:
+					if b == 0 {
 						return errors.New("Division by 0!")
 					}
-					program.getScope(0).pushExp(val2 / val1)
-				case "+":
-					program.getScope(0).pushExp(val2 + val1)
-				case "-":
-					program.getScope(0).pushExp(val2 - val1)
+					program.push(FloatValue(a / b))
+				case OperatorMod:
+					if b == 0 {
+						return errors.New("Division by 0!")
+					}
+					program.push(FloatValue(math.Mod(a, b)))
+				case OperatorAdd:
+					program.push(FloatValue(a + b))
+				case OperatorSub:
+					program.push(FloatValue(a - b))
 				}
 
 				return nil
@@ -731,59 +874,92 @@ func mathOperation(program *Program, opcode *Opcode) error {
 		return errors.New("Can't perform math operation!")
 	}
 
-	if operation == "!=" || operation == "==" || operation == ">" || operation == ">=" || operation == "<=" || operation == "<" {
-		val1, err1 := program.getScope(0).popExp()
+	if operator == OperatorEqual || operator == OperatorNotEqual {
+		val1, err1 := program.pop()
 		if err1 != nil {
 			return err1
 		}
-		val2, err2 := program.getScope(0).popExp()
+		val2, err2 := program.pop()
 		if err2 != nil {
 			return err2
 		}
-		if val1, ok := val1.(int); ok {
-			if val2, ok := val2.(int); ok {
-				switch operation {
-				case "==":
-					program.getScope(0).pushExp(val2 == val1)
-				case "!=":
-					program.getScope(0).pushExp(val2 != val1)
-				case ">":
-					program.getScope(0).pushExp(val2 > val1)
-				case ">=":
-					program.getScope(0).pushExp(val2 >= val1)
-				case "<":
-					program.getScope(0).pushExp(val2 < val1)
-				case "<=":
-					program.getScope(0).pushExp(val2 <= val1)
-				}
 
-				return nil
+		equal, ok := val2.equals(val1)
+		if !ok {
+			return errors.New("Wrong operation!")
+		}
+
+		program.push(BoolValue(equal == (operator == OperatorEqual)))
+		return nil
+	}
+
+	if operator >= OperatorGreater && operator <= OperatorLessEqual {
+		val1, err1 := program.pop()
+		if err1 != nil {
+			return err1
+		}
+		val2, err2 := program.pop()
+		if err2 != nil {
+			return err2
+		}
+
+		var compared int
+		if val1.Kind() == KindInt && val2.Kind() == KindInt {
+			compared = compare(val2.Int(), val1.Int())
+		} else if b, ok := val1.toFloat(); ok {
+			a, ok := val2.toFloat()
+			if !ok {
+				return errors.New("Wrong operation!")
 			}
+			compared = compare(a, b)
+		} else if val1.Kind() == KindString && val2.Kind() == KindString {
+			compared = compare(val2.String(), val1.String())
+		} else {
+			return errors.New("Wrong operation!")
 		}
 
+		switch operator {
+		case OperatorGreater:
+			program.push(BoolValue(compared > 0))
+		case OperatorGreaterEqual:
+			program.push(BoolValue(compared >= 0))
+		case OperatorLess:
+			program.push(BoolValue(compared < 0))
+		case OperatorLessEqual:
+			program.push(BoolValue(compared <= 0))
+		}
+
+		return nil
 	}
+
 	return errors.New("Wrong operation!")
 }
 
-func getFunctionArguments(program *Program) []any {
-	x := len(program.functionArgsStack) - *program.functionArgumentCount
-	x1 := len(program.functionArgsStack)
-	arguments := program.functionArgsStack[x:x1]
-
-	program.functionArgsStack = program.functionArgsStack[0 : len(program.functionArgsStack)-*program.functionArgumentCount]
-	*program.functionArgumentCount = 0
+func compare[T int | float64 | string](a T, b T) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
 
-	return arguments
+	return 0
 }
 
-func (program *Program) popFunctionArgument() any {
-	x := len(program.functionArgsStack) - 1
-	argument := program.functionArgsStack[x]
+// getFunctionArguments takes arguments of called buildin or host function from the stack,
+// returned slice is valid only until next value is pushed
+func getFunctionArguments(program *Program) []Value {
+	x := len(program.stack) - program.functionArgumentCount
+	if x < 0 {
+		x = 0
+	}
 
-	program.functionArgsStack = program.functionArgsStack[0 : len(program.functionArgsStack)-1]
-	*program.functionArgumentCount = 0
+	arguments := program.stack[x:]
 
-	return argument
+	program.stack = program.stack[0:x]
+	program.functionArgumentCount = 0
+
+	return arguments
 }
 
 func findLabel(program *Program, label string) (int, error) {
@@ -0,0 +1,52 @@
+package karboscript
+
+import "errors"
+
+// foreachIterator keeps state of foreach loop. Collection is copied when loop starts so changes
+// made to it inside of the loop body don't change number of iterations.
+type foreachIterator struct {
+	keys     []Value
+	values   []Value
+	mapValue *Map
+	position int
+}
+
+func newForeachIterator(collection Value) (*foreachIterator, error) {
+	if collection.Kind() == KindArray {
+		values := make([]Value, len(collection.Array()))
+		copy(values, collection.Array())
+
+		return &foreachIterator{nil, values, nil, 0}, nil
+	}
+
+	if mapValue := collection.Map(); mapValue != nil {
+		return &foreachIterator{mapValue.getKeys(), nil, mapValue, 0}, nil
+	}
+
+	return nil, errors.New("foreach needs array or map!")
+}
+
+// next returns key and value of next element. Keys removed from map during the loop are skipped.
+func (iterator *foreachIterator) next() (Value, Value, bool) {
+	if iterator.mapValue != nil {
+		for iterator.position < len(iterator.keys) {
+			key := iterator.keys[iterator.position]
+			iterator.position++
+
+			if value, ok := iterator.mapValue.get(key); ok {
+				return key, value, true
+			}
+		}
+
+		return Value{}, Value{}, false
+	}
+
+	if iterator.position >= len(iterator.values) {
+		return Value{}, Value{}, false
+	}
+
+	index := iterator.position
+	iterator.position++
+
+	return IntValue(index), iterator.values[index], true
+}
@@ -0,0 +1,82 @@
+package karboscript
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"sync"
+)
+
+// Input is buffered standard input of scripts. Runs (or calls of Script functions) which get
+// the same Input in ExecuteOptions share its buffer, input buffered but not read by one run is
+// read by the next one.
+type Input struct {
+	lock   sync.Mutex
+	reader *bufio.Reader
+	// pending gets line of read which was still waiting when its run was cancelled
+	pending chan inputLine
+}
+
+type inputLine struct {
+	text string
+	err  error
+}
+
+// NewInput returns Input which reads the reader, *bufio.Reader is used as it is
+func NewInput(reader io.Reader) *Input {
+	buffered, isBuffered := reader.(*bufio.Reader)
+	if !isBuffered {
+		buffered = bufio.NewReader(reader)
+	}
+
+	return &Input{reader: buffered}
+}
+
+var standardInput struct {
+	once  sync.Once
+	input *Input
+}
+
+// stdinInput returns Input of os.Stdin shared by every run which doesn't have its own input
+func stdinInput() *Input {
+	standardInput.once.Do(func() {
+		standardInput.input = NewInput(os.Stdin)
+	})
+
+	return standardInput.input
+}
+
+// readLine reads next line, the wait is stopped when ctx is cancelled. Reader can't be interrupted
+// so the read keeps waiting in its goroutine, line it reads isn't lost but returned by the next
+// readLine of the same input. Go code shouldn't read the input itself after cancelled run.
+func (input *Input) readLine(ctx context.Context) (string, error) {
+	input.lock.Lock()
+	pending := input.pending
+	input.pending = nil
+	input.lock.Unlock()
+
+	if pending == nil {
+		// context which can't be cancelled doesn't need goroutine
+		if ctx.Done() == nil {
+			return input.reader.ReadString('\n')
+		}
+
+		pending = make(chan inputLine, 1)
+		go func() {
+			text, err := input.reader.ReadString('\n')
+			pending <- inputLine{text, err}
+		}()
+	}
+
+	select {
+	case line := <-pending:
+		return line.text, line.err
+	case <-ctx.Done():
+		input.lock.Lock()
+		input.pending = pending
+		input.lock.Unlock()
+
+		return "", ctx.Err()
+	}
+}
@@ -0,0 +1,59 @@
+package karboscript
+
+import "errors"
+
+// Target is label the opcode jumps to. Index of the labeled opcode is set by link.
+type Target struct {
+	Name   string
+	Index  int
+	linked bool
+}
+
+// link resolves jump targets to opcode indexes so jumps don't have to search for the label when they are executed
+func link(opcodes []*Opcode) error {
+	labels := map[string]int{}
+	for i, opcode := range opcodes {
+		if opcode.Label == nil {
+			continue
+		}
+		if _, ok := labels[*opcode.Label]; !ok {
+			labels[*opcode.Label] = i
+		}
+	}
+
+	for _, opcode := range opcodes {
+		if opcode.Jump.Name == "" || opcode.Jump.linked {
+			continue
+		}
+
+		index, ok := labels[opcode.Jump.Name]
+		if !ok {
+			// buildin and host functions don't have label
+			if opcode.Operation == OpCallFunction {
+				continue
+			}
+
+			return errors.New("can't find label: " + opcode.Jump.Name)
+		}
+
+		opcode.Jump = Target{opcode.Jump.Name, index, true}
+	}
+
+	return nil
+}
+
+// jumpTo moves code pointer to the target, targets which weren't linked are searched by label
+func jumpTo(program *Program, target Target) error {
+	if target.linked {
+		program.codePointer = target.Index
+		return nil
+	}
+
+	index, err := findLabel(program, target.Name)
+	if err != nil {
+		return err
+	}
+
+	program.codePointer = index
+	return nil
+}
@@ -0,0 +1,69 @@
+package karboscript
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Map struct {
+	keys   []Value
+	values map[Value]Value
+}
+
+func newMap() *Map {
+	return &Map{[]Value{}, map[Value]Value{}}
+}
+
+func (m *Map) get(key Value) (Value, bool) {
+	if !key.isScalar() {
+		return Value{}, false
+	}
+
+	value, ok := m.values[key]
+	return value, ok
+}
+
+func (m *Map) has(key Value) bool {
+	_, ok := m.get(key)
+	return ok
+}
+
+func (m *Map) set(key Value, value Value) {
+	if !m.has(key) {
+		m.keys = append(m.keys, key)
+	}
+
+	m.values[key] = value
+}
+
+func (m *Map) delete(key Value) {
+	if !m.has(key) {
+		return
+	}
+
+	delete(m.values, key)
+
+	for i, existing := range m.keys {
+		if existing == key {
+			m.keys = append(m.keys[0:i], m.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+func (m *Map) getKeys() []Value {
+	keys := make([]Value, len(m.keys))
+	copy(keys, m.keys)
+
+	return keys
+}
+
+func (m *Map) String() string {
+	elements := make([]string, len(m.keys))
+
+	for i, key := range m.keys {
+		elements[i] = fmt.Sprintf("%v:%v", key, m.values[key])
+	}
+
+	return "map[" + strings.Join(elements, " ") + "]"
+}
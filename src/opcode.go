@@ -1,20 +1,38 @@
 package karboscript
 
 import (
-	"errors"
 	"strconv"
 	"strings"
+
+	"github.com/alecthomas/participle/v2/lexer"
 )
 
 type OpCodes struct {
 	List []*Opcode
 }
 
+// Opcode is single instruction of the VM. Operation says which of the operands are used.
 type Opcode struct {
-	Operation string
-	Arguments []any
-	Label     *string
-	Position  string
+	Operation Operation
+	// Name is name of variable, function, struct, field or foreach iterator
+	Name string
+	// Type is type of declared variable or return type of called function
+	Type string
+	// Operator is used by exp_call and logic_end
+	Operator Operator
+	// Value is constant pushed by push_exp
+	Value Value
+	// Count is number of arguments of called function, for function it's number of its variable
+	// slots set by resolveSlots
+	Count int
+	// Names is struct field path, field and type pairs of new struct or key and value variables of foreach
+	Names []string
+	// Jump is label the operation jumps to, its index is set by link
+	Jump Target
+	// Slots are places of variables used by the operation, they are set by resolveSlots
+	Slots    []Slot
+	Label    *string
+	Position string
 }
 
 type ParseError struct {
@@ -27,8 +45,30 @@ func (m *ParseError) Error() string {
 
 type ParsedCode struct {
 	functions   map[string]Function
+	structs     map[string]Struct
 	stack       *[]*Opcode
-	parsedError error
+	diagnostics Diagnostics
+	loops       []LoopLabels
+	hosts       map[string]hostFunction
+}
+
+func (parsed *ParsedCode) addError(pos lexer.Position, message string) {
+	parsed.diagnostics = append(parsed.diagnostics, newDiagnostic(pos, message))
+}
+
+const startLabel = "_start"
+
+type LoopLabels struct {
+	breakLabel    string
+	continueLabel string
+}
+
+func (parsed *ParsedCode) pushLoop(breakLabel string, continueLabel string) {
+	parsed.loops = append(parsed.loops, LoopLabels{breakLabel, continueLabel})
+}
+
+func (parsed *ParsedCode) popLoop() {
+	parsed.loops = parsed.loops[0 : len(parsed.loops)-1]
 }
 
 func (parsed *ParsedCode) append(opcode *Opcode) {
@@ -37,8 +77,8 @@ func (parsed *ParsedCode) append(opcode *Opcode) {
 
 func parseFunctionBody(parsed *ParsedCode, function *Function) error {
 	parseBody(parsed, function.Body)
-	if (*(*parsed).stack)[len(*(*parsed).stack)-1].Operation != "function_return" {
-		parsed.append(&Opcode{"function_return", []any{}, nil, function.Pos.String()})
+	if operation := (*(*parsed).stack)[len(*(*parsed).stack)-1].Operation; operation != OpFunctionReturn && operation != OpReturnValue {
+		parsed.append(&Opcode{Operation: OpFunctionReturn, Position: function.Pos.String()})
 	}
 	return nil
 }
@@ -54,9 +94,11 @@ func parseBody(parsed *ParsedCode, statements []*Statement) error {
 func parseStatement(parsed *ParsedCode, statement *Statement) {
 	if statement.FunctionCall != nil {
 		parseFunctionCall(parsed, statement.FunctionCall)
+		parsed.append(&Opcode{Operation: OpDrop, Position: statement.FunctionCall.Pos.String()})
 	}
 	if statement.Expression != nil {
-		parseExpresionWithNewScope(parsed, statement.Expression)
+		parseExpresion(parsed, statement.Expression)
+		parsed.append(&Opcode{Operation: OpDrop, Position: statement.Expression.Pos.String()})
 	}
 	if statement.ReturnStmt != nil {
 		parseReturnStmt(parsed, statement.ReturnStmt)
@@ -67,6 +109,9 @@ func parseStatement(parsed *ParsedCode, statement *Statement) {
 	if statement.ArrayAssigment != nil {
 		parseArrayAssigment(parsed, statement.ArrayAssigment)
 	}
+	if statement.FieldAssigment != nil {
+		parseFieldAssigment(parsed, statement.FieldAssigment)
+	}
 	if statement.If != nil {
 		parseIf(parsed, statement.If)
 	}
@@ -79,60 +124,122 @@ func parseStatement(parsed *ParsedCode, statement *Statement) {
 	if statement.ForInc != nil {
 		parseForInc(parsed, statement.ForInc)
 	}
+	if statement.Foreach != nil {
+		parseForeach(parsed, statement.Foreach)
+	}
+	if statement.Break != nil {
+		parseBreak(parsed, statement.Break)
+	}
+	if statement.Continue != nil {
+		parseContinue(parsed, statement.Continue)
+	}
+}
+
+func parseBreak(parsed *ParsedCode, breakStmt *Break) {
+	if len(parsed.loops) == 0 {
+		parsed.addError(breakStmt.Pos, "break used outside of loop!")
+		return
+	}
+
+	loop := parsed.loops[len(parsed.loops)-1]
+	parsed.append(&Opcode{Operation: OpJmp, Jump: Target{Name: loop.breakLabel}, Position: breakStmt.Pos.String()})
+}
+
+func parseContinue(parsed *ParsedCode, continueStmt *Continue) {
+	if len(parsed.loops) == 0 {
+		parsed.addError(continueStmt.Pos, "continue used outside of loop!")
+		return
+	}
+
+	loop := parsed.loops[len(parsed.loops)-1]
+	parsed.append(&Opcode{Operation: OpJmp, Jump: Target{Name: loop.continueLabel}, Position: continueStmt.Pos.String()})
 }
 
 func parseWhile(parsed *ParsedCode, while *While) {
 	labelBeforeExpresion := newLabel(parsed, "while")
-	parsed.append(&Opcode{"while_start", []any{}, &labelBeforeExpresion, while.Pos.String()})
+	parsed.append(&Opcode{Operation: OpWhileStart, Label: &labelBeforeExpresion, Position: while.Pos.String()})
 
-	parseExpresionWithNewScope(parsed, &while.Condition)
+	parseExpresion(parsed, &while.Condition)
 
 	label := newLabel(parsed, "while")
 
-	parsed.append(&Opcode{"while", []any{label}, nil, while.Pos.String()})
+	parsed.append(&Opcode{Operation: OpWhile, Jump: Target{Name: label}, Position: while.Pos.String()})
+	parsed.pushLoop(label, labelBeforeExpresion)
 	parseBody(parsed, while.Body)
-	parsed.append(&Opcode{"jmp", []any{labelBeforeExpresion}, nil, while.Pos.String()})
+	parsed.popLoop()
+	parsed.append(&Opcode{Operation: OpJmp, Jump: Target{Name: labelBeforeExpresion}, Position: while.Pos.String()})
 
-	parsed.append(&Opcode{"while_else", []any{}, &label, while.Pos.String()})
+	parsed.append(&Opcode{Operation: OpWhileElse, Label: &label, Position: while.Pos.String()})
 }
 
 func parseFor(parsed *ParsedCode, forStmt *For) {
 	parseStatement(parsed, &forStmt.Init)
 
 	labelBeforeExpresion := newLabel(parsed, "for")
-	parsed.append(&Opcode{"for_start", []any{}, &labelBeforeExpresion, forStmt.Pos.String()})
+	parsed.append(&Opcode{Operation: OpForStart, Label: &labelBeforeExpresion, Position: forStmt.Pos.String()})
 
-	parseExpresionWithNewScope(parsed, &forStmt.Condition)
+	parseExpresion(parsed, &forStmt.Condition)
 
 	label := newLabel(parsed, "for")
+	continueLabel := newLabel(parsed, "for_continue")
 
-	parsed.append(&Opcode{"for", []any{label}, nil, forStmt.Pos.String()})
+	parsed.append(&Opcode{Operation: OpFor, Jump: Target{Name: label}, Position: forStmt.Pos.String()})
+	parsed.pushLoop(label, continueLabel)
 	parseBody(parsed, forStmt.Body)
+	parsed.popLoop()
+
+	parsed.append(&Opcode{Operation: OpForContinue, Label: &continueLabel, Position: forStmt.Pos.String()})
 	parseStatement(parsed, &forStmt.Increment)
 
-	parsed.append(&Opcode{"jmp", []any{labelBeforeExpresion}, nil, forStmt.Pos.String()})
+	parsed.append(&Opcode{Operation: OpJmp, Jump: Target{Name: labelBeforeExpresion}, Position: forStmt.Pos.String()})
 
-	parsed.append(&Opcode{"for_end", []any{}, &label, forStmt.Pos.String()})
+	parsed.append(&Opcode{Operation: OpForEnd, Label: &label, Position: forStmt.Pos.String()})
 }
 
 func parseForInc(parsed *ParsedCode, forStmt *ForInc) {
-	parseExpresionWithNewScope(parsed, &forStmt.ExpressionA)
+	parseExpresion(parsed, &forStmt.ExpressionA)
 
-	parsed.append(&Opcode{"set_local_var_exp", []any{"int", forStmt.Variable.Value}, nil, forStmt.Pos.String()})
+	parsed.append(&Opcode{Operation: OpSetLocalVarExp, Type: "int", Name: forStmt.Variable.Value, Position: forStmt.Pos.String()})
 
-	parseExpresionWithNewScope(parsed, &forStmt.ExpressionB)
+	parseExpresion(parsed, &forStmt.ExpressionB)
 
-	parsed.append(&Opcode{"set_local_var_exp", []any{"int", forStmt.Variable.Value + "_end"}, nil, forStmt.Pos.String()})
+	parsed.append(&Opcode{Operation: OpSetLocalVarExp, Type: "int", Name: forStmt.Variable.Value + "_end", Position: forStmt.Pos.String()})
 
 	incLabelStart := newLabel(parsed, "forinc")
 	incLabelEnd := newLabel(parsed, "forinc_e")
-	parsed.append(&Opcode{"forinc_start", []any{forStmt.Variable.Value, incLabelEnd}, &incLabelStart, forStmt.Pos.String()})
+	incLabelContinue := newLabel(parsed, "forinc_c")
+	parsed.append(&Opcode{Operation: OpForincStart, Name: forStmt.Variable.Value, Jump: Target{Name: incLabelEnd}, Label: &incLabelStart, Position: forStmt.Pos.String()})
 
+	parsed.pushLoop(incLabelEnd, incLabelContinue)
 	parseBody(parsed, forStmt.Body)
+	parsed.popLoop()
+
+	parsed.append(&Opcode{Operation: OpForinc, Name: forStmt.Variable.Value, Jump: Target{Name: incLabelStart}, Label: &incLabelContinue, Position: forStmt.Pos.String()})
+
+	parsed.append(&Opcode{Operation: OpForincEnd, Label: &incLabelEnd, Position: forStmt.Pos.String()})
+}
+
+func parseForeach(parsed *ParsedCode, foreach *Foreach) {
+	parseExpresion(parsed, &foreach.Collection)
+
+	labelStart := newLabel(parsed, "foreach")
+	labelEnd := newLabel(parsed, "foreach_e")
+	iterator := labelStart
 
-	parsed.append(&Opcode{"forinc", []any{forStmt.Variable.Value, incLabelStart}, nil, forStmt.Pos.String()})
+	keyName := ""
+	if foreach.Key != nil {
+		keyName = foreach.Key.Value
+	}
+
+	parsed.append(&Opcode{Operation: OpForeachInit, Name: iterator, Position: foreach.Pos.String()})
+	parsed.append(&Opcode{Operation: OpForeachNext, Name: iterator, Names: []string{keyName, foreach.Value.Value}, Jump: Target{Name: labelEnd}, Label: &labelStart, Position: foreach.Pos.String()})
 
-	parsed.append(&Opcode{"forinc_end", []any{}, &incLabelEnd, forStmt.Pos.String()})
+	parsed.pushLoop(labelEnd, labelStart)
+	parseBody(parsed, foreach.Body)
+	parsed.popLoop()
+
+	parsed.append(&Opcode{Operation: OpJmp, Jump: Target{Name: labelStart}, Position: foreach.Pos.String()})
+	parsed.append(&Opcode{Operation: OpForeachEnd, Name: iterator, Label: &labelEnd, Position: foreach.Pos.String()})
 }
 
 func newLabel(parsed *ParsedCode, labelType string) string {
@@ -142,74 +249,162 @@ func newLabel(parsed *ParsedCode, labelType string) string {
 }
 
 func parseIf(parsed *ParsedCode, ifStmt *If) {
-	parseExpresionWithNewScope(parsed, &ifStmt.Condition)
+	parseExpresion(parsed, &ifStmt.Condition)
 
-	lenStack := len(*(*parsed).stack)
-	label := "_if." + strconv.FormatInt(int64(lenStack), 16)
+	label := newLabel(parsed, "if")
 
-	parsed.append(&Opcode{"if", []any{label}, nil, ifStmt.Pos.String()})
+	parsed.append(&Opcode{Operation: OpIf, Jump: Target{Name: label}, Position: ifStmt.Pos.String()})
 	parseBody(parsed, ifStmt.Body)
 
-	parsed.append(&Opcode{"if_else", []any{}, &label, ifStmt.Pos.String()})
+	if ifStmt.Else == nil {
+		parsed.append(&Opcode{Operation: OpIfElse, Label: &label, Position: ifStmt.Pos.String()})
+		return
+	}
+
+	labelEnd := newLabel(parsed, "if_end")
+	parsed.append(&Opcode{Operation: OpJmp, Jump: Target{Name: labelEnd}, Position: ifStmt.Pos.String()})
+	parsed.append(&Opcode{Operation: OpIfElse, Label: &label, Position: ifStmt.Else.Pos.String()})
+
+	if ifStmt.Else.If != nil {
+		parseIf(parsed, ifStmt.Else.If)
+	} else {
+		parseBody(parsed, ifStmt.Else.Body)
+	}
 
+	parsed.append(&Opcode{Operation: OpIfEnd, Label: &labelEnd, Position: ifStmt.Pos.String()})
 }
 
 func parseAssigment(parsed *ParsedCode, assigment *Assigment) {
-	parseExpresionWithNewScope(parsed, &assigment.Expression)
-	parsed.append(&Opcode{"set_local_var_exp", []any{assigment.VarType.Value, assigment.Variable.Value}, nil, assigment.Pos.String()})
+	if assigment.Operator == "=" {
+		parseExpresion(parsed, assigment.Expression)
+	} else {
+		parsed.append(&Opcode{Operation: OpPushExpVar, Name: assigment.Variable.Value, Position: assigment.Pos.String()})
+		parseCompoundValue(parsed, assigment.Operator, assigment.Increment, assigment.Expression, assigment.Pos.String())
+	}
+	parsed.append(&Opcode{Operation: OpSetLocalVarExp, Type: assigment.VarType.Value, Name: assigment.Variable.Value, Position: assigment.Pos.String()})
 }
 
 func parseArrayAssigment(parsed *ParsedCode, assigment *ArrayAssigment) {
 	if assigment.Index != nil {
-		parseExpresionWithNewScope(parsed, assigment.Index)
-		parsed.append(&Opcode{"push_last_exp", []any{}, nil, assigment.Pos.GoString()})
-		parseExpresionWithNewScope(parsed, &assigment.Expression)
-		parsed.append(&Opcode{"push_last_exp", []any{}, nil, assigment.Pos.GoString()})
-		parsed.append(&Opcode{"set_array_var_exp", []any{assigment.Variable.Value}, nil, assigment.Pos.String()})
+		parseExpresion(parsed, assigment.Index)
+		if assigment.Operator == "=" {
+			parseExpresion(parsed, assigment.Expression)
+		} else {
+			parsed.append(&Opcode{Operation: OpPushArrCallPeek, Name: assigment.Variable.Value, Position: assigment.Pos.String()})
+			parseCompoundValue(parsed, assigment.Operator, assigment.Increment, assigment.Expression, assigment.Pos.String())
+		}
+		parsed.append(&Opcode{Operation: OpSetArrayVarExp, Name: assigment.Variable.Value, Position: assigment.Pos.String()})
+	} else {
+		if assigment.Operator != "=" {
+			parsed.addError(assigment.Pos, "can't use "+assigment.Operator+assigment.Increment+" when pushing to array!")
+			return
+		}
+		parseExpresion(parsed, assigment.Expression)
+		parsed.append(&Opcode{Operation: OpAddArrExp, Name: assigment.Variable.Value, Position: assigment.Pos.String()})
+	}
+}
+
+func parseFieldAssigment(parsed *ParsedCode, assigment *FieldAssigment) {
+	path := append([]string{assigment.Variable.Value}, assigment.Fields...)
+
+	if assigment.Operator == "=" {
+		parseExpresion(parsed, assigment.Expression)
 	} else {
-		parseExpresionWithNewScope(parsed, &assigment.Expression)
-		parsed.append(&Opcode{"add_arr_exp", []any{assigment.Variable.Value}, nil, assigment.Pos.String()})
+		parsed.append(&Opcode{Operation: OpPushStructField, Names: path, Position: assigment.Pos.String()})
+		parseCompoundValue(parsed, assigment.Operator, assigment.Increment, assigment.Expression, assigment.Pos.String())
+	}
+	parsed.append(&Opcode{Operation: OpSetStructFieldVarExp, Names: path, Position: assigment.Pos.String()})
+}
+
+// parseCompoundValue expects current value of the assigned variable on the expresion stack
+func parseCompoundValue(parsed *ParsedCode, operator string, increment string, expression *Expression, position string) {
+	if increment != "" {
+		parsed.append(&Opcode{Operation: OpPushExp, Value: IntValue(1), Position: position})
+		parsed.append(&Opcode{Operation: OpExpCall, Operator: operatorFromString(increment[0:1]), Position: position})
+		return
 	}
+
+	parseExpresion(parsed, expression)
+	parsed.append(&Opcode{Operation: OpExpCall, Operator: operatorFromString(operator[0:1]), Position: position})
 }
 
 func parseFunctionCall(parsed *ParsedCode, functionCall *FunctionCall) {
-	// todo check function declaration before making opcodes (like checking types of called function and numer of arguments)
+	if structDeclaration, ok := parsed.structs[functionCall.FunctionName]; ok {
+		parseStructConstruct(parsed, &structDeclaration, functionCall)
+		return
+	}
+
 	for _, argument := range functionCall.Arguments {
-		parseExpresionWithNewScope(parsed, argument)
-		parsed.append(&Opcode{"push_function_arg", []any{}, nil, functionCall.Pos.String()})
+		parseExpresion(parsed, argument)
 	}
 
 	if function, ok := parsed.functions[functionCall.FunctionName]; ok {
 		if function.ReturnType != nil {
-			parsed.append(&Opcode{"call_function", []any{functionCall.FunctionName, len(functionCall.Arguments), function.ReturnType.Value}, nil, functionCall.Pos.String()})
+			parsed.append(&Opcode{Operation: OpCallFunction, Name: functionCall.FunctionName, Count: len(functionCall.Arguments), Type: function.ReturnType.Value, Jump: Target{Name: "_function." + functionCall.FunctionName}, Position: functionCall.Pos.String()})
 			return
 		} else {
-			parsed.append(&Opcode{"call_function", []any{functionCall.FunctionName, len(functionCall.Arguments)}, nil, functionCall.Pos.String()})
+			parsed.append(&Opcode{Operation: OpCallFunction, Name: functionCall.FunctionName, Count: len(functionCall.Arguments), Jump: Target{Name: "_function." + functionCall.FunctionName}, Position: functionCall.Pos.String()})
 			return
 		}
 	}
 
-	if _, ok := buildInFunctions[functionCall.FunctionName]; ok {
-		parsed.append(&Opcode{"call_function", []any{functionCall.FunctionName, len(functionCall.Arguments)}, nil, functionCall.Pos.String()})
+	_, isBuildIn := buildInFunctions[functionCall.FunctionName]
+	_, isHost := parsed.hosts[functionCall.FunctionName]
+	if isBuildIn || isHost {
+		parsed.append(&Opcode{Operation: OpCallFunction, Name: functionCall.FunctionName, Count: len(functionCall.Arguments), Jump: Target{Name: "_function." + functionCall.FunctionName}, Position: functionCall.Pos.String()})
 
 	} else {
-		parsed.parsedError = errors.New("Can't find " + functionCall.FunctionName + " function!")
+		parsed.addError(functionCall.Pos, "Can't find "+functionCall.FunctionName+" function!")
 	}
 }
 
-func parseReturnStmt(parsed *ParsedCode, returnStmt *ReturnStmt) {
-	parseExpresionWithNewScope(parsed, &returnStmt.Expression)
-	parsed.append(&Opcode{"push_bellow", []any{}, nil, returnStmt.Pos.String()})
-	parsed.append(&Opcode{"function_return", []any{}, nil, returnStmt.Pos.String()})
+func parseStructConstruct(parsed *ParsedCode, structDeclaration *Struct, functionCall *FunctionCall) {
+	if len(functionCall.Arguments) != len(structDeclaration.Fields) {
+		parsed.addError(functionCall.Pos, structDeclaration.Name+" needs "+strconv.Itoa(len(structDeclaration.Fields))+" arguments, got "+strconv.Itoa(len(functionCall.Arguments))+"!")
+		return
+	}
+
+	definition := []string{}
+	for _, field := range structDeclaration.Fields {
+		definition = append(definition, field.Name, field.VarType.Value)
+	}
+
+	parsed.append(&Opcode{Operation: OpPushNewStruct, Name: structDeclaration.Name, Names: definition, Position: functionCall.Pos.String()})
+
+	for i, argument := range functionCall.Arguments {
+		parseExpresion(parsed, argument)
+		parsed.append(&Opcode{Operation: OpSetStructFieldExp, Name: structDeclaration.Fields[i].Name, Position: argument.Pos.String()})
+	}
 }
 
-func parseExpresionWithNewScope(parsed *ParsedCode, expression *Expression) {
-	parsed.append(&Opcode{"add_scope", []any{}, nil, expression.Pos.GoString()})
-	parseExpresion(parsed, expression)
-	parsed.append(&Opcode{"sub_scope", []any{}, nil, expression.Pos.GoString()})
+func parseReturnStmt(parsed *ParsedCode, returnStmt *ReturnStmt) {
+	parseExpresion(parsed, &returnStmt.Expression)
+	parsed.append(&Opcode{Operation: OpReturnValue, Position: returnStmt.Pos.String()})
 }
 
 func parseExpresion(parsed *ParsedCode, expression *Expression) {
+	parseAndExpresion(parsed, expression.Left)
+
+	for _, opTerm := range expression.Right {
+		label := newLabel(parsed, "or")
+		parsed.append(&Opcode{Operation: OpOr, Jump: Target{Name: label}, Position: opTerm.Pos.String()})
+		parseAndExpresion(parsed, opTerm.Term)
+		parsed.append(&Opcode{Operation: OpLogicEnd, Operator: operatorFromString(opTerm.Operator), Label: &label, Position: opTerm.Pos.String()})
+	}
+}
+
+func parseAndExpresion(parsed *ParsedCode, expression *AndExpression) {
+	parseCompareExpresion(parsed, expression.Left)
+
+	for _, opTerm := range expression.Right {
+		label := newLabel(parsed, "and")
+		parsed.append(&Opcode{Operation: OpAnd, Jump: Target{Name: label}, Position: opTerm.Pos.String()})
+		parseCompareExpresion(parsed, opTerm.Term)
+		parsed.append(&Opcode{Operation: OpLogicEnd, Operator: operatorFromString(opTerm.Operator), Label: &label, Position: opTerm.Pos.String()})
+	}
+}
+
+func parseCompareExpresion(parsed *ParsedCode, expression *CompareExpression) {
 	parseComTerm(parsed, expression.Left)
 	parseRightComExpresion(parsed, expression.Right)
 }
@@ -217,7 +412,7 @@ func parseExpresion(parsed *ParsedCode, expression *Expression) {
 func parseRightComExpresion(parsed *ParsedCode, opComTerm []*OpComTerm) {
 	for _, opTerm := range opComTerm {
 		parseComTerm(parsed, opTerm.Term)
-		parsed.append(&Opcode{"exp_call", []any{opTerm.Operator}, nil, opTerm.Pos.String()})
+		parsed.append(&Opcode{Operation: OpExpCall, Operator: operatorFromString(opTerm.Operator), Position: opTerm.Pos.String()})
 	}
 }
 
@@ -233,7 +428,7 @@ func parseRightTerm(parsed *ParsedCode, opTerm []*OpTerm) {
 func parseOpTerm(parsed *ParsedCode, opTerms []*OpTerm) {
 	for _, opTerm := range opTerms {
 		parseTerm(parsed, opTerm.Term)
-		parsed.append(&Opcode{"exp_call", []any{opTerm.Operator}, nil, opTerm.Pos.String()})
+		parsed.append(&Opcode{Operation: OpExpCall, Operator: operatorFromString(opTerm.Operator), Position: opTerm.Pos.String()})
 	}
 }
 
@@ -249,28 +444,32 @@ func parseTerm(parsed *ParsedCode, term *Term) {
 func parseOpFactor(parsed *ParsedCode, opFactors []*OpFactor) {
 	for _, opFactor := range opFactors {
 		parseFactor(parsed, opFactor.Factor)
-		parsed.append(&Opcode{"exp_call", []any{opFactor.Operator}, nil, opFactor.Pos.String()})
+		parsed.append(&Opcode{Operation: OpExpCall, Operator: operatorFromString(opFactor.Operator), Position: opFactor.Pos.String()})
 	}
 }
 
 func parseFactor(parsed *ParsedCode, factor *Factor) {
 	if factor.Value != nil {
 		if factor.Value.Float != nil {
-			parsed.append(&Opcode{"push_exp", []any{factor.Value.Float.Value}, nil, factor.Pos.String()})
+			parsed.append(&Opcode{Operation: OpPushExp, Value: FloatValue(factor.Value.Float.Value), Position: factor.Pos.String()})
 		} else if factor.Value.Integer != nil {
-			parsed.append(&Opcode{"push_exp", []any{factor.Value.Integer.Value}, nil, factor.Pos.String()})
+			parsed.append(&Opcode{Operation: OpPushExp, Value: IntValue(factor.Value.Integer.Value), Position: factor.Pos.String()})
 		} else if factor.Value.String != nil {
 			stripSlash := strings.ReplaceAll(factor.Value.String.Value, "\\\"", "\"")
-			parsed.append(&Opcode{"push_exp", []any{stripSlash[1 : len(stripSlash)-1]}, nil, factor.Pos.String()})
+			parsed.append(&Opcode{Operation: OpPushExp, Value: StringValue(stripSlash[1 : len(stripSlash)-1]), Position: factor.Pos.String()})
 		} else if factor.Value.Boolean != nil {
-			parsed.append(&Opcode{"push_exp", []any{factor.Value.Boolean.Value}, nil, factor.Pos.String()})
+			parsed.append(&Opcode{Operation: OpPushExp, Value: BoolValue(factor.Value.Boolean.Value == "true"), Position: factor.Pos.String()})
 		}
 	}
 	if factor.FunctionCall != nil {
 		parseFunctionCall(parsed, factor.FunctionCall)
 	}
 	if factor.Variable != nil {
-		parsed.append(&Opcode{"push_exp_var", []any{factor.Variable.Value}, nil, factor.Pos.String()})
+		parsed.append(&Opcode{Operation: OpPushExpVar, Name: factor.Variable.Value, Position: factor.Pos.String()})
+	}
+	if factor.FieldCall != nil {
+		path := append([]string{factor.FieldCall.Name}, factor.FieldCall.Fields...)
+		parsed.append(&Opcode{Operation: OpPushStructField, Names: path, Position: factor.Pos.String()})
 	}
 	if factor.Subexpression != nil {
 		parseExpresion(parsed, factor.Subexpression)
@@ -281,69 +480,132 @@ func parseFactor(parsed *ParsedCode, factor *Factor) {
 	if factor.ArrayLiteral != nil {
 		parseArrayLiteral(parsed, factor.ArrayLiteral)
 	}
+	if factor.MapLiteral != nil {
+		parseMapLiteral(parsed, factor.MapLiteral)
+	}
+	if factor.Negative != nil {
+		if factor.Negative.Value != nil && factor.Negative.Value.Integer != nil {
+			parsed.append(&Opcode{Operation: OpPushExp, Value: IntValue(-factor.Negative.Value.Integer.Value), Position: factor.Pos.String()})
+		} else if factor.Negative.Value != nil && factor.Negative.Value.Float != nil {
+			parsed.append(&Opcode{Operation: OpPushExp, Value: FloatValue(-factor.Negative.Value.Float.Value), Position: factor.Pos.String()})
+		} else {
+			parsed.append(&Opcode{Operation: OpPushExp, Value: IntValue(0), Position: factor.Pos.String()})
+			parseFactor(parsed, factor.Negative)
+			parsed.append(&Opcode{Operation: OpExpCall, Operator: OperatorSub, Position: factor.Pos.String()})
+		}
+	}
+	if factor.Not != nil {
+		parseFactor(parsed, factor.Not)
+		parsed.append(&Opcode{Operation: OpExpCall, Operator: OperatorNot, Position: factor.Pos.String()})
+	}
 }
 
 func parseArrayLiteral(parsed *ParsedCode, arrayLiteral *ArrayLiteral) {
-	parsed.append(&Opcode{"push_empty_arr", []any{}, nil, arrayLiteral.Pos.String()})
+	parsed.append(&Opcode{Operation: OpPushEmptyArr, Position: arrayLiteral.Pos.String()})
 
 	for _, element := range arrayLiteral.Elements {
-		parseExpresionWithNewScope(parsed, element)
-		parsed.append(&Opcode{"push_arr_exp", []any{}, nil, arrayLiteral.Pos.String()})
+		parseExpresion(parsed, element)
+		parsed.append(&Opcode{Operation: OpPushArrExp, Position: arrayLiteral.Pos.String()})
+	}
+}
+
+func parseMapLiteral(parsed *ParsedCode, mapLiteral *MapLiteral) {
+	parsed.append(&Opcode{Operation: OpPushEmptyMap, Position: mapLiteral.Pos.String()})
+
+	for _, element := range mapLiteral.Elements {
+		parseExpresion(parsed, element.Key)
+		parseExpresion(parsed, element.Value)
+		parsed.append(&Opcode{Operation: OpPushMapExp, Position: element.Pos.String()})
 	}
 }
 
 func parseArrayCall(parsed *ParsedCode, arrayCall *ArrayCall) {
-	parseExpresionWithNewScope(parsed, arrayCall.Index)
-	parsed.append(&Opcode{"push_arr_call", []any{arrayCall.Name}, nil, arrayCall.Pos.String()})
+	parseExpresion(parsed, arrayCall.Index)
+	parsed.append(&Opcode{Operation: OpPushArrCall, Name: arrayCall.Name, Position: arrayCall.Pos.String()})
 
 }
 
-func parseFunction(parsed *ParsedCode, function *Function) error {
+func parseFunction(parsed *ParsedCode, function *Function) {
 	label := "_function." + function.Name
 
-	for _, OpCode := range *(*parsed).stack {
-		if OpCode.Label != nil && *OpCode.Label == label {
-			return errors.New("function " + function.Name + " is already declared")
-		}
-	}
+	*(*parsed).stack = append(*(*parsed).stack, &Opcode{Operation: OpFunction, Label: &label, Position: function.Pos.String()})
 
-	*(*parsed).stack = append(*(*parsed).stack, &Opcode{"function", []any{}, &label, function.Pos.String()})
-
-	for _, argument := range function.Arguments {
-		*(*parsed).stack = append(*(*parsed).stack, &Opcode{"set_local_var_arg", []any{argument.VarType.Value, argument.Variable.Value}, nil, function.Pos.String()})
+	// arguments are popped from the top of the stack so the last one is set first
+	for i := len(function.Arguments) - 1; i >= 0; i-- {
+		argument := function.Arguments[i]
+		*(*parsed).stack = append(*(*parsed).stack, &Opcode{Operation: OpSetLocalVarArg, Type: argument.VarType.Value, Name: argument.Variable.Value, Position: function.Pos.String()})
 	}
 
-	err := parseFunctionBody(parsed, function)
-	if err != nil {
-		return err
-	}
-	return nil
+	parseFunctionBody(parsed, function)
+}
+
+func parseGlobal(parsed *ParsedCode, global *Global) {
+	parseExpresion(parsed, &global.Expression)
+	parsed.append(&Opcode{Operation: OpSetLocalVarExp, Type: global.VarType.Value, Name: global.Variable.Value, Position: global.Pos.String()})
 }
 
 func registerFunction(parsed *ParsedCode, function *Function) {
 	parsed.functions[function.Name] = *function
 }
 
+func registerStruct(parsed *ParsedCode, structDeclaration *Struct) {
+	parsed.structs[structDeclaration.Name] = *structDeclaration
+}
+
+var buildInTypes = []string{"array", "map", "string", "int", "float", "bool"}
+
 func GetOpcodes(code *Code) ([]*Opcode, error) {
-	parsed := ParsedCode{map[string]Function{}, &[]*Opcode{}, nil}
+	return getOpcodes(code, nil)
+}
+
+func getOpcodes(code *Code, hosts map[string]hostFunction) ([]*Opcode, error) {
+	opcodes, err := compileCode(code, hosts, true)
+	if err != nil {
+		return opcodes, err
+	}
+
+	opcodes = append(opcodes, &Opcode{Operation: OpCallFunction, Name: "main", Jump: Target{Name: "_function.main"}}, &Opcode{Operation: OpExit})
+
+	if err := link(opcodes); err != nil {
+		return opcodes, err
+	}
+
+	return opcodes, resolveSlots(opcodes)
+}
+
+// compileCode returns opcodes of functions followed by initialization of global variables which
+// starts at start label, they aren't linked yet
+func compileCode(code *Code, hosts map[string]hostFunction, requireMain bool) ([]*Opcode, error) {
+	if diagnostics := check(code, hosts, requireMain); diagnostics.HasErrors() {
+		return nil, diagnostics
+	}
+
+	parsed := ParsedCode{map[string]Function{}, map[string]Struct{}, &[]*Opcode{}, Diagnostics{}, []LoopLabels{}, hosts}
 
 	var opcodes []*Opcode
 
+	for _, structDeclaration := range code.Structs {
+		registerStruct(&parsed, structDeclaration)
+	}
+
 	for _, function := range code.Functions {
 		registerFunction(&parsed, function)
 	}
 
 	for _, function := range code.Functions {
-		err := parseFunction(&parsed, function)
-		if err != nil {
-			return nil, err
-		}
+		parseFunction(&parsed, function)
+	}
+
+	label := startLabel
+	parsed.append(&Opcode{Operation: OpStart, Label: &label})
+
+	for _, global := range code.Globals {
+		parseGlobal(&parsed, global)
 	}
 
-	if parsed.parsedError != nil {
-		return opcodes, parsed.parsedError
+	if parsed.diagnostics.HasErrors() {
+		return opcodes, parsed.diagnostics
 	}
-	opcodes = append(*parsed.stack, &Opcode{"call_function", []any{"main", 0}, nil, ""}, &Opcode{"exit", []any{"main", 0}, nil, ""})
 
-	return opcodes, nil
+	return *parsed.stack, nil
 }
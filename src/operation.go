@@ -0,0 +1,179 @@
+package karboscript
+
+import "strconv"
+
+// Operation is instruction executed by the VM
+type Operation uint8
+
+const (
+	OpExit Operation = iota
+	OpStart
+	OpFunction
+	OpFunctionReturn
+	OpReturnValue
+	OpPushExp
+	OpPushExpVar
+	OpDrop
+	OpPushEmptyArr
+	OpPushArrExp
+	OpPushEmptyMap
+	OpPushMapExp
+	OpPushNewStruct
+	OpSetStructFieldExp
+	OpPushStructField
+	OpSetStructFieldVarExp
+	OpAddArrExp
+	OpPushArrCall
+	OpPushArrCallPeek
+	OpSetLocalVarArg
+	OpSetLocalVarExp
+	OpSetArrayVarExp
+	OpExpCall
+	OpIf
+	OpIfElse
+	OpIfEnd
+	OpAnd
+	OpOr
+	OpLogicEnd
+	OpJmp
+	OpWhileStart
+	OpWhile
+	OpWhileElse
+	OpForStart
+	OpFor
+	OpForContinue
+	OpForEnd
+	OpForincStart
+	OpForinc
+	OpForincEnd
+	OpForeachInit
+	OpForeachNext
+	OpForeachEnd
+	OpCallFunction
+	operationCount
+)
+
+// operationNames are names of operations used in opcode listing
+var operationNames = [operationCount]string{
+	OpExit:                 "exit",
+	OpStart:                "start",
+	OpFunction:             "function",
+	OpFunctionReturn:       "function_return",
+	OpReturnValue:          "return_value",
+	OpPushExp:              "push_exp",
+	OpPushExpVar:           "push_exp_var",
+	OpDrop:                 "drop",
+	OpPushEmptyArr:         "push_empty_arr",
+	OpPushArrExp:           "push_arr_exp",
+	OpPushEmptyMap:         "push_empty_map",
+	OpPushMapExp:           "push_map_exp",
+	OpPushNewStruct:        "push_new_struct",
+	OpSetStructFieldExp:    "set_struct_field_exp",
+	OpPushStructField:      "push_struct_field",
+	OpSetStructFieldVarExp: "set_struct_field_var_exp",
+	OpAddArrExp:            "add_arr_exp",
+	OpPushArrCall:          "push_arr_call",
+	OpPushArrCallPeek:      "push_arr_call_peek",
+	OpSetLocalVarArg:       "set_local_var_arg",
+	OpSetLocalVarExp:       "set_local_var_exp",
+	OpSetArrayVarExp:       "set_array_var_exp",
+	OpExpCall:              "exp_call",
+	OpIf:                   "if",
+	OpIfElse:               "if_else",
+	OpIfEnd:                "if_end",
+	OpAnd:                  "and",
+	OpOr:                   "or",
+	OpLogicEnd:             "logic_end",
+	OpJmp:                  "jmp",
+	OpWhileStart:           "while_start",
+	OpWhile:                "while",
+	OpWhileElse:            "while_else",
+	OpForStart:             "for_start",
+	OpFor:                  "for",
+	OpForContinue:          "for_continue",
+	OpForEnd:               "for_end",
+	OpForincStart:          "forinc_start",
+	OpForinc:               "forinc",
+	OpForincEnd:            "forinc_end",
+	OpForeachInit:          "foreach_init",
+	OpForeachNext:          "foreach_next",
+	OpForeachEnd:           "foreach_end",
+	OpCallFunction:         "call_function",
+}
+
+func (operation Operation) String() string {
+	if operation < operationCount {
+		return operationNames[operation]
+	}
+
+	return "operation(" + strconv.Itoa(int(operation)) + ")"
+}
+
+// holdsLabelOnly reports whether the operation does nothing, it's only there to hold label
+func (operation Operation) holdsLabelOnly() bool {
+	switch operation {
+	case OpStart, OpIfElse, OpIfEnd, OpWhileStart, OpWhileElse, OpForStart, OpForContinue, OpForEnd, OpForincEnd:
+		return true
+	}
+
+	return false
+}
+
+// Operator is math, compare or logical operator used by exp_call and logic_end
+type Operator uint8
+
+const (
+	OperatorNone Operator = iota
+	OperatorAdd
+	OperatorSub
+	OperatorMul
+	OperatorDiv
+	OperatorMod
+	OperatorEqual
+	OperatorNotEqual
+	OperatorGreater
+	OperatorGreaterEqual
+	OperatorLess
+	OperatorLessEqual
+	OperatorNot
+	OperatorAnd
+	OperatorOr
+	operatorCount
+)
+
+var operatorNames = [operatorCount]string{
+	OperatorNone:         "",
+	OperatorAdd:          "+",
+	OperatorSub:          "-",
+	OperatorMul:          "*",
+	OperatorDiv:          "/",
+	OperatorMod:          "%",
+	OperatorEqual:        "==",
+	OperatorNotEqual:     "!=",
+	OperatorGreater:      ">",
+	OperatorGreaterEqual: ">=",
+	OperatorLess:         "<",
+	OperatorLessEqual:    "<=",
+	OperatorNot:          "!",
+	OperatorAnd:          "&&",
+	OperatorOr:           "||",
+}
+
+func (operator Operator) String() string {
+	if operator < operatorCount {
+		return operatorNames[operator]
+	}
+
+	return "operator(" + strconv.Itoa(int(operator)) + ")"
+}
+
+// operatorFromString returns operator written in the code
+func operatorFromString(name string) Operator {
+	for operator, operatorName := range operatorNames {
+		if operatorName == name {
+			return Operator(operator)
+		}
+	}
+
+	return OperatorNone
+}
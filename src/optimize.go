@@ -0,0 +1,126 @@
+package karboscript
+
+// Optimize returns optimized copy of opcodes made by GetOpcodes. It folds operations on constants
+// and makes jumps which land on another jmp go straight to its target. Output of the script doesn't change.
+func Optimize(opcodes []*Opcode) ([]*Opcode, error) {
+	optimized := make([]*Opcode, len(opcodes))
+	for i, opcode := range opcodes {
+		copied := *opcode
+		copied.Jump = Target{Name: opcode.Jump.Name}
+		optimized[i] = &copied
+	}
+
+	optimized = foldConstants(optimized)
+
+	collapseJumps(optimized)
+
+	if err := link(optimized); err != nil {
+		return nil, err
+	}
+
+	return optimized, resolveSlots(optimized)
+}
+
+// foldConstants replaces push_exp of constants followed by exp_call with push_exp of the result.
+// Operations which fail (like division by 0) are kept so they fail when the script runs.
+func foldConstants(opcodes []*Opcode) []*Opcode {
+	folded := make([]*Opcode, 0, len(opcodes))
+
+	for _, opcode := range opcodes {
+		folded = append(folded, opcode)
+
+		if opcode.Operation != OpExpCall || opcode.Label != nil {
+			continue
+		}
+
+		operands := 2
+		if opcode.Operator == OperatorNot {
+			operands = 1
+		}
+
+		if len(folded) < operands+1 {
+			continue
+		}
+
+		constants := folded[len(folded)-operands-1 : len(folded)-1]
+		foldable := true
+		for i, constant := range constants {
+			// only the first opcode can have label, it's moved to the result
+			if constant.Operation != OpPushExp || (i > 0 && constant.Label != nil) {
+				foldable = false
+			}
+		}
+		if !foldable {
+			continue
+		}
+
+		program := &Program{}
+		for _, constant := range constants {
+			program.push(constant.Value)
+		}
+
+		if err := mathOperation(program, opcode); err != nil {
+			continue
+		}
+
+		result, err := program.pop()
+		if err != nil {
+			continue
+		}
+
+		folded = folded[:len(folded)-operands-1]
+		folded = append(folded, &Opcode{Operation: OpPushExp, Value: result, Label: constants[0].Label, Position: opcode.Position})
+	}
+
+	return folded
+}
+
+// collapseJumps makes jumps which land on jmp (maybe after opcodes which only hold label)
+// jump straight to the final target
+func collapseJumps(opcodes []*Opcode) {
+	labels := labelIndexes(opcodes)
+
+	for _, opcode := range opcodes {
+		if opcode.Jump.Name == "" || opcode.Operation == OpCallFunction {
+			continue
+		}
+
+		target := opcode.Jump.Name
+		visited := map[string]bool{target: true}
+
+		for {
+			index, ok := labels[target]
+			for ok && index < len(opcodes) && opcodes[index].Operation.holdsLabelOnly() {
+				index++
+			}
+			if !ok || index >= len(opcodes) || opcodes[index].Operation != OpJmp {
+				break
+			}
+
+			next := opcodes[index].Jump.Name
+			if visited[next] {
+				break
+			}
+
+			visited[next] = true
+			target = next
+		}
+
+		opcode.Jump = Target{Name: target}
+	}
+}
+
+func labelIndexes(opcodes []*Opcode) map[string]int {
+	labels := map[string]int{}
+
+	for i, opcode := range opcodes {
+		if opcode.Label == nil {
+			continue
+		}
+		if _, ok := labels[*opcode.Label]; !ok {
+			labels[*opcode.Label] = i
+		}
+	}
+
+	return labels
+}
@@ -10,7 +10,32 @@ import (
 )
 
 type Code struct {
-	Functions []*Function `@@*`
+	Structs   []*Struct   `( @@`
+	Functions []*Function `| @@`
+	Globals   []*Global   `| @@ )*`
+}
+
+type Global struct {
+	Pos lexer.Position
+
+	Const      bool       `@"const"?`
+	VarType    VarType    `@@`
+	Variable   Variable   `@@`
+	Expression Expression `"=" @@ ";"`
+}
+
+type Struct struct {
+	Pos lexer.Position
+
+	Name   string         `"struct" @Ident "{"`
+	Fields []*StructField `@@* "}"`
+}
+
+type StructField struct {
+	Pos lexer.Position
+
+	VarType VarType `@@`
+	Name    string  `@Ident ";"`
 }
 
 type Function struct {
@@ -28,33 +53,51 @@ type Statement struct {
 	If             *If             `(@@ `
 	For            *For            `| @@ `
 	ForInc         *ForInc         `| @@ `
+	Foreach        *Foreach        `| @@ `
 	While          *While          `| @@ ) | `
-	ReturnStmt     *ReturnStmt     `( @@ `
+	Break          *Break          `( @@ `
+	Continue       *Continue       `| @@ `
+	ReturnStmt     *ReturnStmt     `| @@ `
 	ArrayAssigment *ArrayAssigment `| @@ `
+	FieldAssigment *FieldAssigment `| @@ `
 	Assigment      *Assigment      `| @@ `
 	FunctionCall   *FunctionCall   `| @@`
 	Expression     *Expression     `| @@) ";"`
 }
 
 type VarType struct {
-	Value string `@("array" | "string" | "int" | "float" | "bool")`
+	Value string `@("array" | "map" | "string" | "int" | "float" | "bool" | Ident)`
 }
 
 type Assigment struct {
 	Pos lexer.Position
 
-	VarType    VarType    `@@?`
+	VarType    VarType    `(@@ (?= Ident | "<"))?`
 	ExtraTypes []*VarType `[ "<" @@ ("," @@)* ">"]`
-	Variable   Variable   `@@`
-	Expression Expression `"=" @@`
+	Variable   Variable    `@@`
+	Operator   string      `( @("+""=" | "-""=" | "*""=" | "/""=" | "%""=" | "=")`
+	Expression *Expression `  @@`
+	Increment  string      `| @("+""+" | "-""-") )`
 }
 
 type ArrayAssigment struct {
 	Pos lexer.Position
 
-	Variable   Variable   `@@ "["`
+	Variable   Variable    `@@ "["`
 	Index      *Expression `@@? "]"`
-	Expression Expression `"=" @@`
+	Operator   string      `( @("+""=" | "-""=" | "*""=" | "/""=" | "%""=" | "=")`
+	Expression *Expression `  @@`
+	Increment  string      `| @("+""+" | "-""-") )`
+}
+
+type FieldAssigment struct {
+	Pos lexer.Position
+
+	Variable   Variable    `@@`
+	Fields     []string    `("." @Ident)+`
+	Operator   string      `( @("+""=" | "-""=" | "*""=" | "/""=" | "%""=" | "=")`
+	Expression *Expression `  @@`
+	Increment  string      `| @("+""+" | "-""-") )`
 }
 
 type ReturnStmt struct {
@@ -63,6 +106,18 @@ type ReturnStmt struct {
 	Expression Expression `"return" @@`
 }
 
+type Break struct {
+	Pos lexer.Position
+
+	Keyword string `@"break"`
+}
+
+type Continue struct {
+	Pos lexer.Position
+
+	Keyword string `@"continue"`
+}
+
 type FunctionCall struct {
 	Pos lexer.Position
 
@@ -75,6 +130,14 @@ type If struct {
 
 	Condition Expression   `"if" @@`
 	Body      []*Statement `"{" @@* "}"`
+	Else      *Else        `("else" @@)?`
+}
+
+type Else struct {
+	Pos lexer.Position
+
+	If   *If          `@@`
+	Body []*Statement `| "{" @@* "}"`
 }
 
 type While struct {
@@ -101,6 +164,15 @@ type ForInc struct {
 	Body        []*Statement `"{" @@* "}"`
 }
 
+type Foreach struct {
+	Pos lexer.Position
+
+	Collection Expression   `"foreach" @@ "as"`
+	Key        *Variable    `(@@ ",")?`
+	Value      Variable     `@@`
+	Body       []*Statement `"{" @@* "}"`
+}
+
 type Argument struct {
 	Pos lexer.Position
 
@@ -108,7 +180,7 @@ type Argument struct {
 	Variable Variable `@@`
 }
 
-type Value struct {
+type Literal struct {
 	Pos lexer.Position
 
 	Integer *Integer `@@`
@@ -154,27 +226,51 @@ type ArrayCall struct {
 	Index *Expression `@@ "]"`
 }
 
+type FieldCall struct {
+	Pos lexer.Position
+
+	Name   string   `@Ident`
+	Fields []string `("." @Ident)+`
+}
+
 type ArrayLiteral struct {
 	Pos lexer.Position
 
 	Elements []*Expression `"[" [@@ ("," @@)*] "]"`
 }
 
+type MapLiteral struct {
+	Pos lexer.Position
+
+	Elements []*MapElement `"{" [@@ ("," @@)*] "}"`
+}
+
+type MapElement struct {
+	Pos lexer.Position
+
+	Key   *Expression `@@ ":"`
+	Value *Expression `@@`
+}
+
 type Factor struct {
 	Pos lexer.Position
 
 	ArrayCall     *ArrayCall    `(@@`
 	FunctionCall  *FunctionCall `| @@`
-	Value         *Value        `| @@`
+	FieldCall     *FieldCall    `| @@`
+	Value         *Literal      `| @@`
 	Subexpression *Expression   `| "(" @@ ")"`
 	Variable      *Variable     `| @@`
-	ArrayLiteral  *ArrayLiteral `| @@)`
+	ArrayLiteral  *ArrayLiteral `| @@`
+	MapLiteral    *MapLiteral   `| @@`
+	Not           *Factor       `| "!" @@`
+	Negative      *Factor       `| "-" @@)`
 }
 
 type OpFactor struct {
 	Pos lexer.Position
 
-	Operator string  `@("*" | "/")`
+	Operator string  `@("*" | "/" | "%")`
 	Factor   *Factor `@@`
 }
 
@@ -202,17 +298,45 @@ type ComTerm struct {
 type OpComTerm struct {
 	Pos lexer.Position
 
-	Operator string   `@("=""=" | "!""=" | ">" | "<" | ">""=" | "<""=")`
+	Operator string   `@("=""=" | "!""=" | ">""=" | "<""=" | ">" | "<")`
 	Term     *ComTerm `@@`
 }
 
-type Expression struct {
+type CompareExpression struct {
 	Pos lexer.Position
 
 	Left  *ComTerm     `@@`
 	Right []*OpComTerm `@@*`
 }
 
+type OpCompareExpression struct {
+	Pos lexer.Position
+
+	Operator string             `@("&""&")`
+	Term     *CompareExpression `@@`
+}
+
+type AndExpression struct {
+	Pos lexer.Position
+
+	Left  *CompareExpression     `@@`
+	Right []*OpCompareExpression `@@*`
+}
+
+type OpAndExpression struct {
+	Pos lexer.Position
+
+	Operator string         `@("|""|")`
+	Term     *AndExpression `@@`
+}
+
+type Expression struct {
+	Pos lexer.Position
+
+	Left  *AndExpression     `@@`
+	Right []*OpAndExpression `@@*`
+}
+
 var (
 	karboScriptLexer = lexer.NewTextScannerLexer(func(s *scanner.Scanner) {
 		s.Mode &^= scanner.ScanChars
@@ -0,0 +1,127 @@
+package karboscript
+
+import (
+	"errors"
+	"strconv"
+)
+
+// HostFunction is Go function which can be called from the script
+type HostFunction func(args []Value) (Value, error)
+
+// Signature declares types of host function arguments and its return type.
+// Nil Arguments accepts any number of arguments of any type, empty ReturnType means function returns nothing.
+type Signature struct {
+	Arguments  []string
+	ReturnType string
+}
+
+type hostFunction struct {
+	signature Signature
+	function  HostFunction
+}
+
+// Runtime compiles and executes scripts which can call Go functions registered in it
+type Runtime struct {
+	functions map[string]hostFunction
+}
+
+func NewRuntime() *Runtime {
+	return &Runtime{map[string]hostFunction{}}
+}
+
+// Register makes function callable from the script under given name
+func (runtime *Runtime) Register(name string, signature Signature, function HostFunction) error {
+	if name == "" {
+		return errors.New("Function name can't be empty!")
+	}
+	if function == nil {
+		return errors.New("Function " + name + " can't be nil!")
+	}
+	if _, ok := buildInFunctions[name]; ok {
+		return errors.New("Function " + name + " is buildin function!")
+	}
+	if _, ok := runtime.functions[name]; ok {
+		return errors.New("Function " + name + " is already registered!")
+	}
+
+	for _, argument := range signature.Arguments {
+		if !isHostType(argument) {
+			return errors.New("Function " + name + " has unknown argument type " + argument + "!")
+		}
+	}
+	if signature.ReturnType != "" && !isHostType(signature.ReturnType) {
+		return errors.New("Function " + name + " has unknown return type " + signature.ReturnType + "!")
+	}
+
+	runtime.functions[name] = hostFunction{signature, function}
+	return nil
+}
+
+// GetOpcodes compiles the code the same way as GetOpcodes function, calls of registered functions are allowed
+func (runtime *Runtime) GetOpcodes(code *Code) ([]*Opcode, error) {
+	return getOpcodes(code, runtime.functions)
+}
+
+func (runtime *Runtime) Execute(stack *[]*Opcode) error {
+	return runtime.ExecuteWithOptions(stack, ExecuteOptions{})
+}
+
+func (runtime *Runtime) ExecuteWithOptions(stack *[]*Opcode, options ExecuteOptions) error {
+	_, err := run(stack, options, runtime.functions)
+	return err
+}
+
+func isHostType(name string) bool {
+	if name == typeAny {
+		return true
+	}
+
+	for _, buildInType := range buildInTypes {
+		if buildInType == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isValueOfType(value Value, name string) bool {
+	if name == typeAny {
+		return value.Kind() != KindNil
+	}
+
+	return value.TypeName() == name
+}
+
+func callHostFunction(program *Program, name string, host hostFunction) error {
+	// host function can keep the arguments, they can't share memory with the stack
+	arguments := append([]Value{}, getFunctionArguments(program)...)
+
+	if host.signature.Arguments != nil {
+		if len(arguments) != len(host.signature.Arguments) {
+			return errors.New(name + " needs " + strconv.Itoa(len(host.signature.Arguments)) + " arguments, got " + strconv.Itoa(len(arguments)) + "!")
+		}
+
+		for i, argument := range arguments {
+			if !isValueOfType(argument, host.signature.Arguments[i]) {
+				return errors.New("argument " + strconv.Itoa(i+1) + " of " + name + " has to be " + host.signature.Arguments[i] + ", got " + argument.TypeName() + "!")
+			}
+		}
+	}
+
+	result, err := host.function(arguments)
+	if err != nil {
+		return err
+	}
+
+	if host.signature.ReturnType == "" {
+		return nil
+	}
+
+	if !isValueOfType(result, host.signature.ReturnType) {
+		return errors.New(name + " has to return " + host.signature.ReturnType + ", got " + result.TypeName() + "!")
+	}
+
+	program.push(result)
+	return nil
+}
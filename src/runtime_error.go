@@ -0,0 +1,52 @@
+package karboscript
+
+import "strings"
+
+// StackFrame is single active function call at the moment when runtime error happened
+type StackFrame struct {
+	Function     string
+	Position     string
+	CallPosition string
+}
+
+// RuntimeError is returned by Execute when script fails. Use errors.As to get it from returned error.
+type RuntimeError struct {
+	Err      error
+	Opcode   *Opcode
+	Position string
+	// Stack starts with the function in which error happened and ends with main
+	Stack []StackFrame
+}
+
+func newRuntimeError(program *Program, opcode *Opcode, err error) *RuntimeError {
+	stack := []StackFrame{}
+	position := opcode.Position
+
+	// the first frame belongs to global variables, it isn't function call
+	for i := len(program.frames) - 1; i > 0; i-- {
+		frame := program.frames[i]
+		stack = append(stack, StackFrame{frame.functionName, position, frame.callPosition})
+		position = frame.callPosition
+	}
+
+	return &RuntimeError{err, opcode, opcode.Position, stack}
+}
+
+func (runtimeError *RuntimeError) Error() string {
+	return runtimeError.Position + ": " + runtimeError.Err.Error()
+}
+
+func (runtimeError *RuntimeError) Unwrap() error {
+	return runtimeError.Err
+}
+
+// StackTrace returns error message followed by every active function call
+func (runtimeError *RuntimeError) StackTrace() string {
+	lines := []string{runtimeError.Error()}
+
+	for _, frame := range runtimeError.Stack {
+		lines = append(lines, "    at "+frame.Function+" ("+frame.Position+")")
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,223 @@
+package karboscript
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Script is compiled code which functions can be called from Go. Global variables are
+// initialized by the first call and keep their values between calls.
+type Script struct {
+	// opcodes end with exit after initialization of global variables, there is no call of main function
+	opcodes   []*Opcode
+	functions map[string]*Function
+	structs   map[string]*Struct
+	hosts     map[string]hostFunction
+	// lock makes calls run one after another because they share global variables
+	lock        sync.Mutex
+	initialized bool
+	// initErr is error of initialization of global variables, it's returned by every call
+	initErr error
+	globals []Var
+}
+
+// Compile compiles the code once so its functions can be called many times, the code doesn't need main function
+func Compile(code *Code) (*Script, error) {
+	return NewRuntime().Compile(code)
+}
+
+func (runtime *Runtime) Compile(code *Code) (*Script, error) {
+	opcodes, err := compileCode(code, runtime.functions, false)
+	if err != nil {
+		return nil, err
+	}
+
+	opcodes = append(opcodes, &Opcode{Operation: OpExit})
+	if err := link(opcodes); err != nil {
+		return nil, err
+	}
+	if err := resolveSlots(opcodes); err != nil {
+		return nil, err
+	}
+
+	functions := map[string]*Function{}
+	for _, function := range code.Functions {
+		functions[function.Name] = function
+	}
+
+	structs := map[string]*Struct{}
+	for _, structDeclaration := range code.Structs {
+		structs[structDeclaration.Name] = structDeclaration
+	}
+
+	return &Script{opcodes: opcodes, functions: functions, structs: structs, hosts: runtime.functions}, nil
+}
+
+// Call calls function with given arguments, the first call initializes global variables before.
+// When the initialization fails every call returns its error. Arguments are converted to script
+// values, returned value is converted back to Go types (arrays to []any, maps to map[any]any and
+// structs to map[string]any). Struct argument can be map[string]any (like returned struct) or Go
+// struct, its fields are matched by name ignoring case and all of them have to be set.
+func (script *Script) Call(name string, args ...any) (any, error) {
+	return script.CallWithOptions(ExecuteOptions{}, name, args...)
+}
+
+func (script *Script) CallWithOptions(options ExecuteOptions, name string, args ...any) (any, error) {
+	function, ok := script.functions[name]
+	if !ok {
+		return nil, errors.New("Can't find " + name + " function!")
+	}
+
+	if len(args) != len(function.Arguments) {
+		return nil, errors.New(name + " needs " + strconv.Itoa(len(function.Arguments)) + " arguments, got " + strconv.Itoa(len(args)) + "!")
+	}
+
+	script.lock.Lock()
+	defer script.lock.Unlock()
+
+	if !script.initialized {
+		program, err := run(&script.opcodes, options, script.hosts)
+
+		script.initialized = true
+		script.initErr = err
+		if err == nil {
+			script.globals = program.globals
+		}
+	}
+	if script.initErr != nil {
+		return nil, script.initErr
+	}
+
+	stack := make([]*Opcode, len(script.opcodes), len(script.opcodes)+len(args)+2)
+	copy(stack, script.opcodes)
+
+	for i, arg := range args {
+		argumentType := function.Arguments[i].VarType.Value
+
+		value, err := script.valueOf(arg, argumentType)
+		if err != nil {
+			return nil, errors.New("argument " + strconv.Itoa(i+1) + " of " + name + ": " + err.Error())
+		}
+
+		if !isValueOfType(value, argumentType) {
+			return nil, errors.New("argument " + strconv.Itoa(i+1) + " of " + name + " has to be " + argumentType + ", got " + value.TypeName() + "!")
+		}
+
+		stack = append(stack, &Opcode{Operation: OpPushExp, Value: value})
+	}
+
+	call := &Opcode{Operation: OpCallFunction, Name: name, Count: len(args), Jump: Target{Name: "_function." + name}}
+	if function.ReturnType != nil {
+		call.Type = function.ReturnType.Value
+	}
+
+	// returned value stays on the stack
+	stack = append(stack, call, &Opcode{Operation: OpExit})
+
+	program, err := runFrom(&stack, len(script.opcodes), script.globals, options, script.hosts)
+	if program != nil {
+		script.globals = program.globals
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(program.stack) == 0 {
+		return nil, nil
+	}
+
+	result, err := program.pop()
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Interface(), nil
+}
+
+// valueOf converts Go value to script value of given type, unlike ValueOf it can make struct
+func (script *Script) valueOf(value any, varType string) (Value, error) {
+	structDeclaration, ok := script.structs[varType]
+	if !ok {
+		return ValueOf(value)
+	}
+
+	switch value.(type) {
+	case Value, *StructValue:
+		return ValueOf(value)
+	}
+
+	fields := map[string]any{}
+
+	reflected := reflect.ValueOf(value)
+	for reflected.Kind() == reflect.Pointer && !reflected.IsNil() {
+		reflected = reflected.Elem()
+	}
+
+	switch {
+	case reflected.Kind() == reflect.Map && reflected.Type().Key().Kind() == reflect.String:
+		for _, key := range reflected.MapKeys() {
+			fields[key.String()] = reflected.MapIndex(key).Interface()
+		}
+	case reflected.Kind() == reflect.Struct:
+		for i := 0; i < reflected.NumField(); i++ {
+			if reflected.Type().Field(i).IsExported() {
+				fields[reflected.Type().Field(i).Name] = reflected.Field(i).Interface()
+			}
+		}
+	default:
+		return Value{}, fmt.Errorf("Can't convert %T to %s!", value, structDeclaration.Name)
+	}
+
+	definition := []string{}
+	for _, field := range structDeclaration.Fields {
+		definition = append(definition, field.Name, field.VarType.Value)
+	}
+
+	converted, err := newStructValue(structDeclaration.Name, definition)
+	if err != nil {
+		return Value{}, err
+	}
+
+	for _, field := range structDeclaration.Fields {
+		found := false
+
+		for name, fieldValue := range fields {
+			if !strings.EqualFold(name, field.Name) {
+				continue
+			}
+
+			fieldScriptValue, err := script.valueOf(fieldValue, field.VarType.Value)
+			if err != nil {
+				return Value{}, err
+			}
+			if err := converted.setField(field.Name, fieldScriptValue); err != nil {
+				return Value{}, err
+			}
+
+			delete(fields, name)
+			found = true
+			break
+		}
+
+		if !found {
+			return Value{}, errors.New(structDeclaration.Name + " needs field " + field.Name + "!")
+		}
+	}
+
+	if len(fields) > 0 {
+		unknown := []string{}
+		for name := range fields {
+			unknown = append(unknown, name)
+		}
+		sort.Strings(unknown)
+
+		return Value{}, errors.New(structDeclaration.Name + " has no field " + unknown[0] + "!")
+	}
+
+	return structValue(converted), nil
+}
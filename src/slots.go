@@ -0,0 +1,115 @@
+package karboscript
+
+import "errors"
+
+// Slot is place of variable resolved before the script runs. Function which declares the variable
+// uses its local slot, global slot is used until the local variable is declared or when function
+// doesn't declare it at all.
+type Slot struct {
+	// Local is index in variables of the function frame, -1 when the function doesn't declare the variable
+	Local int
+	// Global is index in global variables, -1 when there is no such global variable
+	Global int
+}
+
+// variables returns names of variables used by the opcode, Slots of the opcode have the same order
+func (opcode *Opcode) variables() []string {
+	switch opcode.Operation {
+	case OpPushExpVar, OpAddArrExp, OpPushArrCall, OpPushArrCallPeek, OpSetArrayVarExp, OpSetLocalVarArg, OpSetLocalVarExp, OpForeachInit, OpForeachEnd:
+		return []string{opcode.Name}
+	case OpPushStructField, OpSetStructFieldVarExp:
+		return opcode.Names[:1]
+	case OpForincStart, OpForinc:
+		return []string{opcode.Name, opcode.Name + "_end"}
+	case OpForeachNext:
+		return []string{opcode.Name, opcode.Names[0], opcode.Names[1]}
+	}
+
+	return nil
+}
+
+// declarations returns names of variables declared by the opcode
+func (opcode *Opcode) declarations() []string {
+	switch opcode.Operation {
+	case OpSetLocalVarArg, OpForeachInit:
+		return []string{opcode.Name}
+	case OpSetLocalVarExp:
+		if opcode.Type != "" {
+			return []string{opcode.Name}
+		}
+	case OpForeachNext:
+		if opcode.Names[0] != "" {
+			return opcode.Names
+		}
+		return opcode.Names[1:]
+	}
+
+	return nil
+}
+
+// resolveSlots gives every variable slot in its function or in global variables. Code after start
+// (and before the first function) declares global variables, code after function declares variables
+// of that function. Count of function is set to number of its slots.
+func resolveSlots(opcodes []*Opcode) error {
+	globals := map[string]int{}
+	locals := map[*Opcode]map[string]int{}
+
+	var region *Opcode
+	for _, opcode := range opcodes {
+		if (opcode.Operation == OpForeachNext && len(opcode.Names) != 2) ||
+			((opcode.Operation == OpPushStructField || opcode.Operation == OpSetStructFieldVarExp) && len(opcode.Names) < 2) {
+			return errors.New("Broken " + opcode.Operation.String() + " opcode!")
+		}
+
+		if opcode.Operation == OpFunction || opcode.Operation == OpStart {
+			region = opcode
+			if opcode.Operation == OpFunction {
+				locals[opcode] = map[string]int{}
+			}
+		}
+
+		for _, name := range opcode.declarations() {
+			slots := globals
+			if region != nil && region.Operation == OpFunction {
+				slots = locals[region]
+			}
+
+			if _, ok := slots[name]; !ok {
+				slots[name] = len(slots)
+			}
+		}
+	}
+
+	region = nil
+	for _, opcode := range opcodes {
+		if opcode.Operation == OpFunction || opcode.Operation == OpStart {
+			region = opcode
+		}
+		if opcode.Operation == OpFunction {
+			opcode.Count = len(locals[opcode])
+		}
+
+		names := opcode.variables()
+		if len(names) == 0 {
+			continue
+		}
+
+		opcode.Slots = make([]Slot, len(names))
+		for i, name := range names {
+			slot := Slot{-1, -1}
+
+			if region != nil && region.Operation == OpFunction {
+				if index, ok := locals[region][name]; ok {
+					slot.Local = index
+				}
+			}
+			if index, ok := globals[name]; ok {
+				slot.Global = index
+			}
+
+			opcode.Slots[i] = slot
+		}
+	}
+
+	return nil
+}
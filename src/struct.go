@@ -0,0 +1,97 @@
+package karboscript
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type StructValue struct {
+	name   string
+	fields []string
+	values map[string]*Var
+}
+
+func newStructValue(name string, definition []string) (*StructValue, error) {
+	if len(definition)%2 != 0 {
+		return nil, errors.New("Broken struct definition!")
+	}
+
+	structValue := &StructValue{name, []string{}, map[string]*Var{}}
+
+	for i := 0; i < len(definition); i += 2 {
+		field, fieldType := definition[i], definition[i+1]
+
+		structValue.fields = append(structValue.fields, field)
+		structValue.values[field] = &Var{Value{}, VarType{fieldType}}
+	}
+
+	return structValue, nil
+}
+
+func (structValue *StructValue) getField(name string) (Value, error) {
+	field, ok := structValue.values[name]
+	if !ok {
+		return Value{}, errors.New(structValue.name + " has no field " + name + "!")
+	}
+
+	return field.value, nil
+}
+
+func (structValue *StructValue) setField(name string, value Value) error {
+	field, ok := structValue.values[name]
+	if !ok {
+		return errors.New(structValue.name + " has no field " + name + "!")
+	}
+
+	variable := Var{value, field.varType}
+	if err, ok := validateVariable(variable); !ok {
+		return errors.New(structValue.name + "." + name + ": " + err.Error())
+	}
+
+	field.value = value
+	return nil
+}
+
+func (structValue *StructValue) String() string {
+	elements := make([]string, len(structValue.fields))
+
+	for i, field := range structValue.fields {
+		elements[i] = fmt.Sprintf("%v:%v", field, structValue.values[field].value)
+	}
+
+	return structValue.name + "{" + strings.Join(elements, " ") + "}"
+}
+
+// getStructFromPath walks through fields of struct variable and returns the last struct on the path
+func getStructFromPath(program *Program, slot Slot, path []string) (*StructValue, error) {
+	if len(path) == 0 {
+		return nil, errors.New("Broken field path!")
+	}
+
+	variable := program.variable(slot)
+	if variable == nil {
+		return nil, errors.New("Undeclared variable: " + path[0])
+	}
+
+	value := variable.value
+
+	for _, field := range path[1:] {
+		structValue := value.Struct()
+		if structValue == nil {
+			return nil, errors.New("variable is not struct!")
+		}
+
+		var err error
+		value, err = structValue.getField(field)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if structValue := value.Struct(); structValue != nil {
+		return structValue, nil
+	}
+
+	return nil, errors.New("variable is not struct!")
+}
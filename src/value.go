@@ -0,0 +1,324 @@
+package karboscript
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Kind says which type of data the Value holds
+type Kind int
+
+const (
+	KindNil Kind = iota
+	KindInt
+	KindFloat
+	KindBool
+	KindString
+	KindArray
+	KindMap
+	KindStruct
+	kindIterator
+)
+
+// Value is single value used by the VM: on expresion stack, in variables, function arguments and collections
+type Value struct {
+	kind Kind
+	// integer holds int values and bools (1 is true)
+	integer int
+	float   float64
+	text    string
+	// reference holds []Value, *Map, *StructValue or *foreachIterator
+	reference any
+}
+
+func IntValue(value int) Value {
+	return Value{kind: KindInt, integer: value}
+}
+
+func FloatValue(value float64) Value {
+	return Value{kind: KindFloat, float: value}
+}
+
+func BoolValue(value bool) Value {
+	if value {
+		return Value{kind: KindBool, integer: 1}
+	}
+
+	return Value{kind: KindBool}
+}
+
+func StringValue(value string) Value {
+	return Value{kind: KindString, text: value}
+}
+
+func ArrayValue(value []Value) Value {
+	return Value{kind: KindArray, reference: value}
+}
+
+func MapValue(value *Map) Value {
+	return Value{kind: KindMap, reference: value}
+}
+
+func structValue(value *StructValue) Value {
+	return Value{kind: KindStruct, reference: value}
+}
+
+func iteratorValue(value *foreachIterator) Value {
+	return Value{kind: kindIterator, reference: value}
+}
+
+func (value Value) Kind() Kind {
+	return value.kind
+}
+
+func (value Value) Int() int {
+	return value.integer
+}
+
+func (value Value) Float() float64 {
+	return value.float
+}
+
+func (value Value) Bool() bool {
+	return value.integer != 0
+}
+
+func (value Value) Array() []Value {
+	array, _ := value.reference.([]Value)
+	return array
+}
+
+func (value Value) Map() *Map {
+	mapValue, _ := value.reference.(*Map)
+	return mapValue
+}
+
+func (value Value) Struct() *StructValue {
+	structValue, _ := value.reference.(*StructValue)
+	return structValue
+}
+
+func (value Value) iterator() *foreachIterator {
+	iterator, _ := value.reference.(*foreachIterator)
+	return iterator
+}
+
+// toFloat returns number as float, ints are converted
+func (value Value) toFloat() (float64, bool) {
+	switch value.kind {
+	case KindFloat:
+		return value.float, true
+	case KindInt:
+		return float64(value.integer), true
+	}
+
+	return 0, false
+}
+
+// isScalar reports whether the value can be used as map key
+func (value Value) isScalar() bool {
+	switch value.kind {
+	case KindInt, KindFloat, KindBool, KindString:
+		return true
+	}
+
+	return false
+}
+
+// TypeName returns name of the value type the same way as it's written in the script
+func (value Value) TypeName() string {
+	switch value.kind {
+	case KindInt:
+		return "int"
+	case KindFloat:
+		return "float"
+	case KindBool:
+		return "bool"
+	case KindString:
+		return "string"
+	case KindArray:
+		return "array"
+	case KindMap:
+		return "map"
+	case KindStruct:
+		return value.Struct().name
+	case kindIterator:
+		return "iterator"
+	}
+
+	return ""
+}
+
+// String returns text of string values and printed form of other values
+func (value Value) String() string {
+	switch value.kind {
+	case KindInt:
+		return strconv.Itoa(value.integer)
+	case KindFloat:
+		return fmt.Sprint(value.float)
+	case KindBool:
+		return strconv.FormatBool(value.Bool())
+	case KindString:
+		return value.text
+	case KindArray:
+		elements := make([]string, len(value.Array()))
+		for i, element := range value.Array() {
+			elements[i] = element.String()
+		}
+		return "[" + strings.Join(elements, " ") + "]"
+	case KindMap:
+		return value.Map().String()
+	case KindStruct:
+		return value.Struct().String()
+	}
+
+	return "<nil>"
+}
+
+// equals compares two values, ints and floats are compared as numbers. Second result is false
+// when values can't be compared.
+func (value Value) equals(other Value) (bool, bool) {
+	if value.kind == KindInt && other.kind == KindInt {
+		return value.integer == other.integer, true
+	}
+
+	if a, ok := value.toFloat(); ok {
+		if b, ok := other.toFloat(); ok {
+			return a == b, true
+		}
+		return false, false
+	}
+
+	if value.kind != other.kind {
+		return false, false
+	}
+
+	switch value.kind {
+	case KindString:
+		return value.text == other.text, true
+	case KindBool:
+		return value.integer == other.integer, true
+	}
+
+	return false, false
+}
+
+// ValueOf converts Go value to script value. Slices become arrays and Go maps become maps
+// with keys sorted so iteration over them is repeatable.
+func ValueOf(value any) (Value, error) {
+	switch value := value.(type) {
+	case Value:
+		return value, nil
+	case int:
+		return IntValue(value), nil
+	case float64:
+		return FloatValue(value), nil
+	case string:
+		return StringValue(value), nil
+	case bool:
+		return BoolValue(value), nil
+	case *Map:
+		return MapValue(value), nil
+	case *StructValue:
+		return structValue(value), nil
+	}
+
+	reflected := reflect.ValueOf(value)
+
+	switch reflected.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return IntValue(int(reflected.Int())), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return IntValue(int(reflected.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return FloatValue(reflected.Float()), nil
+	case reflect.String:
+		return StringValue(reflected.String()), nil
+	case reflect.Bool:
+		return BoolValue(reflected.Bool()), nil
+	case reflect.Slice, reflect.Array:
+		array := make([]Value, reflected.Len())
+		for i := range array {
+			element, err := ValueOf(reflected.Index(i).Interface())
+			if err != nil {
+				return Value{}, err
+			}
+			array[i] = element
+		}
+		return ArrayValue(array), nil
+	case reflect.Map:
+		keys := reflected.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+
+		m := newMap()
+		for _, key := range keys {
+			mapKey, err := ValueOf(key.Interface())
+			if err != nil {
+				return Value{}, err
+			}
+			if err := validateMapKey(mapKey); err != nil {
+				return Value{}, err
+			}
+
+			mapValue, err := ValueOf(reflected.MapIndex(key).Interface())
+			if err != nil {
+				return Value{}, err
+			}
+			m.set(mapKey, mapValue)
+		}
+		return MapValue(m), nil
+	}
+
+	return Value{}, fmt.Errorf("Can't convert %T to script value!", value)
+}
+
+// Interface converts script value to Go value: arrays to []any, maps to map[any]any
+// and structs to map[string]any
+func (value Value) Interface() any {
+	switch value.kind {
+	case KindInt:
+		return value.integer
+	case KindFloat:
+		return value.float
+	case KindBool:
+		return value.Bool()
+	case KindString:
+		return value.text
+	case KindArray:
+		array := make([]any, len(value.Array()))
+		for i, element := range value.Array() {
+			array[i] = element.Interface()
+		}
+		return array
+	case KindMap:
+		m := map[any]any{}
+		for _, key := range value.Map().keys {
+			element, _ := value.Map().get(key)
+			m[key.Interface()] = element.Interface()
+		}
+		return m
+	case KindStruct:
+		fields := map[string]any{}
+		for _, name := range value.Struct().fields {
+			field, _ := value.Struct().getField(name)
+			fields[name] = field.Interface()
+		}
+		return fields
+	}
+
+	return nil
+}
+
+func validateMapKey(key Value) error {
+	if key.isScalar() {
+		return nil
+	}
+
+	return errors.New("Map key must be string, int, float or bool!")
+}
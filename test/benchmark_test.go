@@ -0,0 +1,184 @@
+package test
+
+import (
+	karboscript "karboScript/src"
+
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+const fibonacciMain = `
+function main() {
+	for (int i = 0; i < 200; i++;) {
+		out(fibonacci(1000000));
+	}
+}`
+
+const fibonacciFunction = `
+function fibonacci(int max) int {
+	int a = 1;
+	int b = 1;
+	while (b < max) {
+		int c = b;
+		b = a + b;
+		a = c;
+	}
+	return b;
+}`
+
+func compileBenchmark(b *testing.B, source string) []*karboscript.Opcode {
+	ast, err := karboscript.ParseString(source)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	opcodes, err := karboscript.GetOpcodes(ast)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	return opcodes
+}
+
+// unlink returns copy of opcodes with label names instead of resolved targets,
+// so every jump has to search for its label
+func unlink(opcodes []*karboscript.Opcode) []*karboscript.Opcode {
+	unlinked := make([]*karboscript.Opcode, len(opcodes))
+
+	for i, opcode := range opcodes {
+		copied := *opcode
+		copied.Jump = karboscript.Target{Name: opcode.Jump.Name}
+		unlinked[i] = &copied
+	}
+
+	return unlinked
+}
+
+func runBenchmark(b *testing.B, opcodes []*karboscript.Opcode) {
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		err := karboscript.ExecuteWithOptions(&opcodes, karboscript.ExecuteOptions{Stdout: io.Discard})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// largeProgram puts functions with loops and ifs before fibonacci, unlinked jumps of the fibonacci
+// loop have to scan over all their opcodes to find the label like in bigger scripts
+func largeProgram(functions int) string {
+	var source strings.Builder
+	source.WriteString(fibonacciMain)
+
+	for i := 0; i < functions; i++ {
+		fmt.Fprintf(&source, `
+function unused%d(int n) int {
+	int sum = 0;
+	while (sum < n) {
+		if (sum %% 2 == 0) {
+			sum += 3;
+		} else {
+			sum++;
+		}
+	}
+	return sum;
+}`, i)
+	}
+
+	source.WriteString(fibonacciFunction)
+
+	return source.String()
+}
+
+func BenchmarkFibonacciLinked(b *testing.B) {
+	runBenchmark(b, compileBenchmark(b, largeProgram(200)))
+}
+
+func BenchmarkFibonacciUnlinked(b *testing.B) {
+	runBenchmark(b, unlink(compileBenchmark(b, largeProgram(200))))
+}
+
+const arithmeticLoop = `
+function main() {
+	int sum = 0;
+	int i = 0;
+	while (i < 10000) {
+		sum = sum + i * 2 % 7;
+		i++;
+	}
+}`
+
+const callLoop = `
+function main() {
+	int sum = 0;
+	for (int i = 0; i < 10000; i++;) {
+		sum = add(sum, i);
+	}
+}
+
+function add(int a, int b) int {
+	return a + b;
+}`
+
+// executedOpcodes returns number of opcodes executed by the script, it's the smallest step budget
+// which the script doesn't exceed
+func executedOpcodes(b *testing.B, opcodes []*karboscript.Opcode) int {
+	low, high := 1, 1<<30
+	for low < high {
+		middle := low + (high-low)/2
+
+		err := karboscript.ExecuteWithOptions(&opcodes, karboscript.ExecuteOptions{MaxSteps: middle, Stdout: io.Discard})
+		if errors.Is(err, karboscript.ErrStepBudgetExceeded) {
+			low = middle + 1
+		} else if err != nil {
+			b.Fatal(err)
+		} else {
+			high = middle
+		}
+	}
+
+	return low
+}
+
+// runLoopBenchmark reports cost of single executed opcode and of single loop iteration, the loop
+// runs 10000 times
+func runLoopBenchmark(b *testing.B, source string) {
+	opcodes := compileBenchmark(b, source)
+	steps := executedOpcodes(b, opcodes)
+
+	start := time.Now()
+	runBenchmark(b, opcodes)
+	elapsed := float64(time.Since(start).Nanoseconds()) / float64(b.N)
+
+	b.ReportMetric(elapsed/float64(steps), "ns/opcode")
+	b.ReportMetric(elapsed/10000, "ns/iteration")
+}
+
+func BenchmarkArithmeticLoop(b *testing.B) {
+	runLoopBenchmark(b, arithmeticLoop)
+}
+
+func BenchmarkFunctionCallLoop(b *testing.B) {
+	runLoopBenchmark(b, callLoop)
+}
+
+const recursiveFibonacci = `
+function main() {
+	out(fibonacci(20));
+}
+
+function fibonacci(int n) int {
+	if (n < 2) {
+		return n;
+	}
+	return fibonacci(n - 1) + fibonacci(n - 2);
+}`
+
+func BenchmarkRecursiveFibonacci(b *testing.B) {
+	runBenchmark(b, compileBenchmark(b, recursiveFibonacci))
+}
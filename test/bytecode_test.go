@@ -0,0 +1,52 @@
+package test
+
+import (
+	karboscript "karboScript/src"
+
+	"bytes"
+	"encoding/binary"
+	"runtime"
+	"testing"
+)
+
+func TestReadBytecodeHugeLengthOfTruncatedFile(t *testing.T) {
+	file := []byte{'K', 'S', 'C', 0, 0, 0}
+	binary.BigEndian.PutUint16(file[4:], karboscript.BytecodeVersion)
+
+	// string table declares 1<<24 strings, but the file ends
+	length := make([]byte, binary.MaxVarintLen64)
+	file = append(file, length[:binary.PutUvarint(length, 1<<24)]...)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	_, err := karboscript.ReadBytecode(bytes.NewReader(file))
+
+	runtime.ReadMemStats(&after)
+
+	if err == nil || err.Error() != "Broken bytecode file!" {
+		t.Fatalf("expected broken bytecode error, got %v", err)
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Fatalf("reading truncated file allocated %d bytes", allocated)
+	}
+}
+
+func TestReadBytecodeInvalidCount(t *testing.T) {
+	for _, count := range []int{-1, 1 << 40} {
+		opcodes := []*karboscript.Opcode{
+			{Operation: karboscript.OpCallFunction, Name: "out", Count: count},
+			{Operation: karboscript.OpExit},
+		}
+
+		var file bytes.Buffer
+		if err := karboscript.WriteBytecode(&file, opcodes); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := karboscript.ReadBytecode(&file)
+		if err == nil || err.Error() != "Broken bytecode file!" {
+			t.Fatalf("count %d: expected broken bytecode error, got %v", count, err)
+		}
+	}
+}
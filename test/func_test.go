@@ -3,7 +3,13 @@ package test
 import (
 	karboscript "karboScript/src"
 
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"strings"
+	"time"
 )
 
 func ExampleFuncTest() {
@@ -79,8 +85,7 @@ func ExampleLocalVarKeepsLocalScopeTest() {
 	if err != nil {
 	}
 
-	opcodes, _ := karboscript.GetOpcodes(ast)
-	err = karboscript.Execute(&opcodes)
+	_, err = karboscript.GetOpcodes(ast)
 
 	fmt.Println(err)
 
@@ -220,3 +225,1226 @@ func ExampleTestArrayPush() {
 	// Output:
 	// 20
 }
+
+func ExampleIfElseTest() {
+	ast, err := karboscript.ParseString("function main() {    if (10 == 12) {        out(\"first\");    } else {        out(\"second\");    }    if (12 > 10) {        out(\"third\");    } else {        out(\"fourth\");    }}")
+
+	if err != nil {
+	}
+
+	opcodes, _ := karboscript.GetOpcodes(ast)
+	_ = karboscript.Execute(&opcodes)
+
+	// Output:
+	// second
+	// third
+}
+
+func ExampleIfElseIfTest() {
+	ast, err := karboscript.ParseString("function main() {    from 0 to 4 as i {        if (i == 0) {            out(\"zero\");        } else if (i == 1) {            out(\"one\");        } else if (i == 2) {            out(\"two\");        } else {            out(\"many\");        }    }}")
+
+	if err != nil {
+	}
+
+	opcodes, _ := karboscript.GetOpcodes(ast)
+	_ = karboscript.Execute(&opcodes)
+
+	// Output:
+	// zero
+	// one
+	// two
+	// many
+}
+
+func ExampleNestedIfElseTest() {
+	ast, err := karboscript.ParseString("function main() {    int a = 5;    if (a > 3) {        if (a > 10) {            out(\"big\");        } else if (a == 5) {            out(\"five\");        } else {            out(\"medium\");        }    } else {        out(\"small\");    }}")
+
+	if err != nil {
+	}
+
+	opcodes, _ := karboscript.GetOpcodes(ast)
+	_ = karboscript.Execute(&opcodes)
+
+	// Output:
+	// five
+}
+
+func ExampleLogicalOperatorsTest() {
+	ast, err := karboscript.ParseString("function main() { out(true && false, true || false, !false, 1 < 2 && 2 < 3 || false, !(1 == 1) || 2 > 3); }")
+
+	if err != nil {
+	}
+
+	opcodes, _ := karboscript.GetOpcodes(ast)
+	_ = karboscript.Execute(&opcodes)
+
+	// Output:
+	// false true true true false
+}
+
+func ExampleLogicalShortCircuitTest() {
+	ast, err := karboscript.ParseString("function main() { if (false && loud(\"and\")) { out(\"no\"); } if (true || loud(\"or\")) { out(\"yes\"); } if (true && loud(\"called\")) { out(\"done\"); } } function loud(string text) bool { out(text); return true; }")
+
+	if err != nil {
+	}
+
+	opcodes, _ := karboscript.GetOpcodes(ast)
+	_ = karboscript.Execute(&opcodes)
+
+	// Output:
+	// yes
+	// called
+	// done
+}
+
+func ExampleLogicalOperatorNeedsBoolTest() {
+	ast, err := karboscript.ParseString("function main() { out(true && 1); }")
+
+	if err != nil {
+	}
+
+	_, err = karboscript.GetOpcodes(ast)
+
+	fmt.Println(err)
+
+	// Output:
+	// 1:28: Logical operator needs bool operands!
+}
+
+func ExampleFloatMathTest() {
+	ast, err := karboscript.ParseString("function main() { float a = 1.5; out(a * 2.0, a + 1, 10 / 4.0, 2 - 0.5, a > 1, a == 1.5, 3 <= 2.5); }")
+
+	if err != nil {
+	}
+
+	opcodes, _ := karboscript.GetOpcodes(ast)
+	_ = karboscript.Execute(&opcodes)
+
+	// Output:
+	// 3 2.5 2.5 1.5 true true false
+}
+
+func ExampleNumberConversionTest() {
+	ast, err := karboscript.ParseString("function main() { int a = int(7.9); float b = float(3); out(a, b / 2, int(\"42\") + 1, float(\"0.25\") * 4); }")
+
+	if err != nil {
+	}
+
+	opcodes, _ := karboscript.GetOpcodes(ast)
+	_ = karboscript.Execute(&opcodes)
+
+	// Output:
+	// 7 1.5 43 1
+}
+
+func ExampleStringOperationsTest() {
+	ast, err := karboscript.ParseString("function main() { string a = \"hello\"; string b = a + \" \" + \"world\"; out(b, a == \"hello\", a != \"hello\", \"abc\" < \"abd\", \"b\" > \"abc\", true == true, true != false); }")
+
+	if err != nil {
+	}
+
+	opcodes, _ := karboscript.GetOpcodes(ast)
+	_ = karboscript.Execute(&opcodes)
+
+	// Output:
+	// hello world true false true true true true
+}
+
+func ExampleStringIndexTest() {
+	ast, err := karboscript.ParseString("function main() { string a = \"karbo\"; string r = \"\"; from 0 to 5 as i { r = a[i] + r; } out(a[0], r); }")
+
+	if err != nil {
+	}
+
+	opcodes, _ := karboscript.GetOpcodes(ast)
+	_ = karboscript.Execute(&opcodes)
+
+	// Output:
+	// k obrak
+}
+
+func ExampleBreakContinueWhileTest() {
+	ast, err := karboscript.ParseString("function main() { int a = 0; while (a < 10) { a = a + 1; if (a == 2) { continue; } if (a == 5) { break; } out(a); } }")
+
+	if err != nil {
+	}
+
+	opcodes, _ := karboscript.GetOpcodes(ast)
+	_ = karboscript.Execute(&opcodes)
+
+	// Output:
+	// 1
+	// 3
+	// 4
+}
+
+func ExampleBreakContinueForTest() {
+	ast, err := karboscript.ParseString("function main() { for int i=0; i<10; i=i+1; { if (i == 1) { continue; } if (i == 4) { break; } out(i); } }")
+
+	if err != nil {
+	}
+
+	opcodes, _ := karboscript.GetOpcodes(ast)
+	_ = karboscript.Execute(&opcodes)
+
+	// Output:
+	// 0
+	// 2
+	// 3
+}
+
+func ExampleBreakContinueForIncTest() {
+	ast, err := karboscript.ParseString("function main() { from 0 to 3 as i { from 0 to 10 as j { if (j == 1) { continue; } if (j == 3) { break; } out(i, j); } } }")
+
+	if err != nil {
+	}
+
+	opcodes, _ := karboscript.GetOpcodes(ast)
+	_ = karboscript.Execute(&opcodes)
+
+	// Output:
+	// 0 0
+	// 0 2
+	// 1 0
+	// 1 2
+	// 2 0
+	// 2 2
+}
+
+func ExampleBreakOutsideLoopTest() {
+	ast, err := karboscript.ParseString("function main() { break; }")
+
+	if err != nil {
+	}
+
+	_, err = karboscript.GetOpcodes(ast)
+
+	fmt.Println(err)
+
+	// Output:
+	// 1:19: break used outside of loop!
+}
+
+func ExampleUnaryMinusAndModuloTest() {
+	ast, err := karboscript.ParseString("function main() { int a = 7; float b = -1.5; out(-a, -3 + 10, 2 - -2, -(a + 1) * 2, b, 17 % 5, -7 % 3, 5.5 % 2); }")
+
+	if err != nil {
+	}
+
+	opcodes, _ := karboscript.GetOpcodes(ast)
+	_ = karboscript.Execute(&opcodes)
+
+	// Output:
+	// -7 7 4 -16 -1.5 2 -1 1.5
+}
+
+func ExampleCompoundAssignmentTest() {
+	ast, err := karboscript.ParseString("function main() { int a = 10; a += 5; a -= 3; a *= 2; a /= 4; a %= 4; out(a); a++; a++; a--; out(a); float f = 1.0; f += 1; out(f); }")
+
+	if err != nil {
+	}
+
+	opcodes, _ := karboscript.GetOpcodes(ast)
+	_ = karboscript.Execute(&opcodes)
+
+	// Output:
+	// 2
+	// 3
+	// 2
+}
+
+func ExampleCompoundArrayAssignmentTest() {
+	ast, err := karboscript.ParseString("function main() { array a = [1, 2, 3]; int i = 0; a[i + 1] += 10; a[2] *= a[1]; a[0]++; a[0]++; out(a[0], a[1], a[2]); for int j = 0; j < 3; j++; { out(j); } }")
+
+	if err != nil {
+	}
+
+	opcodes, _ := karboscript.GetOpcodes(ast)
+	_ = karboscript.Execute(&opcodes)
+
+	// Output:
+	// 3 12 36
+	// 0
+	// 1
+	// 2
+}
+
+func ExampleNegativeArrayIndexAssignmentTest() {
+	ast, err := karboscript.ParseString("function main() { array a = [1, 2, 3]; a[-1] = 5; }")
+
+	if err != nil {
+	}
+
+	opcodes, _ := karboscript.GetOpcodes(ast)
+	err = karboscript.Execute(&opcodes)
+	fmt.Println(err)
+
+	// Output:
+	// 1:40: Index out of range!
+}
+
+func ExampleMapTest() {
+	ast, err := karboscript.ParseString("function main() { map m = {\"a\": 1, \"b\": 2}; m[\"c\"] = 3; m[\"a\"] += 10; out(m[\"a\"], m[\"c\"], len(m), has(m, \"b\"), has(m, \"x\")); delete(m, \"b\"); out(m); }")
+
+	if err != nil {
+	}
+
+	opcodes, _ := karboscript.GetOpcodes(ast)
+	_ = karboscript.Execute(&opcodes)
+
+	// Output:
+	// 11 3 3 true false
+	// map[a:11 c:3]
+}
+
+func ExampleMapIterationTest() {
+	ast, err := karboscript.ParseString("function main() { map m = make(); array k = keys(m); from 0 to len(k) as i { out(k[i], m[k[i]]); } } function make() map { map m = {}; m[3] = \"three\"; m[1] = \"one\"; m[2] = \"two\"; return m; }")
+
+	if err != nil {
+	}
+
+	opcodes, _ := karboscript.GetOpcodes(ast)
+	_ = karboscript.Execute(&opcodes)
+
+	// Output:
+	// 3 three
+	// 1 one
+	// 2 two
+}
+
+func ExampleMapMissingKeyTest() {
+	ast, err := karboscript.ParseString("function main() { map m = {\"a\": 1}; out(m[\"b\"]); }")
+
+	if err != nil {
+	}
+
+	opcodes, _ := karboscript.GetOpcodes(ast)
+	err = karboscript.Execute(&opcodes)
+
+	fmt.Println(err)
+
+	// Output:
+	// 1:41: Key b not found in map!
+}
+
+func ExampleStructTest() {
+	ast, err := karboscript.ParseString("struct Point { int x; int y; } function main() { Point p = Point(1, 2); p.x = 5; p.y += 10; out(p.x, p.y, p); }")
+
+	if err != nil {
+	}
+
+	opcodes, _ := karboscript.GetOpcodes(ast)
+	_ = karboscript.Execute(&opcodes)
+
+	// Output:
+	// 5 12 Point{x:5 y:12}
+}
+
+func ExampleNestedStructTest() {
+	ast, err := karboscript.ParseString("struct Point { int x; int y; } struct Line { Point a; Point b; } function main() { Line l = Line(Point(1, 2), Point(3, 4)); l.b.x = 10; out(length(l)); Point m = move(l.a); out(m.x, l.a.x); } function length(Line l) int { return l.b.x - l.a.x + l.b.y - l.a.y; } function move(Point p) Point { p.x++; return p; }")
+
+	if err != nil {
+	}
+
+	opcodes, _ := karboscript.GetOpcodes(ast)
+	_ = karboscript.Execute(&opcodes)
+
+	// Output:
+	// 11
+	// 2 2
+}
+
+func ExampleStructFieldTypeTest() {
+	ast, err := karboscript.ParseString("struct Point { int x; int y; } function main() { Point p = Point(1, 2); p.x = \"a\"; }")
+
+	if err != nil {
+	}
+
+	_, err = karboscript.GetOpcodes(ast)
+
+	fmt.Println(err)
+
+	// Output:
+	// 1:73: can't assign string to int field p.x!
+}
+
+func ExampleForeachTest() {
+	ast, err := karboscript.ParseString("function main() { array a = [\"a\", \"b\", \"c\"]; foreach a as item { out(item); } foreach a as i, item { if (i == 1) { continue; } out(i, item); } }")
+
+	if err != nil {
+	}
+
+	opcodes, _ := karboscript.GetOpcodes(ast)
+	_ = karboscript.Execute(&opcodes)
+
+	// Output:
+	// a
+	// b
+	// c
+	// 0 a
+	// 2 c
+}
+
+func ExampleForeachAppendTest() {
+	ast, err := karboscript.ParseString("function main() { array a = [1, 2, 3]; foreach a as item { a[] = item * 10; if (item == 2) { break; } } out(len(a), a[3], a[4]); }")
+
+	if err != nil {
+	}
+
+	opcodes, _ := karboscript.GetOpcodes(ast)
+	_ = karboscript.Execute(&opcodes)
+
+	// Output:
+	// 5 10 20
+}
+
+func ExampleForeachMapTest() {
+	ast, err := karboscript.ParseString("function main() { map m = {\"one\": 1, \"two\": 2, \"three\": 3}; foreach m as key, value { delete(m, \"three\"); out(key, value); } foreach m as value { out(value); } }")
+
+	if err != nil {
+	}
+
+	opcodes, _ := karboscript.GetOpcodes(ast)
+	_ = karboscript.Execute(&opcodes)
+
+	// Output:
+	// one 1
+	// two 2
+	// 1
+	// 2
+}
+
+func ExampleGlobalVariableTest() {
+	ast, err := karboscript.ParseString("int counter = 10; function main() { add(); add(); out(counter); int counter = 1; out(counter); } function add() { counter += 1; } array names = [\"a\"];")
+
+	if err != nil {
+	}
+
+	opcodes, _ := karboscript.GetOpcodes(ast)
+	_ = karboscript.Execute(&opcodes)
+
+	// Output:
+	// 12
+	// 1
+}
+
+func ExampleGlobalConstantTest() {
+	ast, err := karboscript.ParseString("const float PI = 3.5; function main() { out(PI * 2); }")
+
+	if err != nil {
+	}
+
+	opcodes, _ := karboscript.GetOpcodes(ast)
+	_ = karboscript.Execute(&opcodes)
+
+	// Output:
+	// 7
+}
+
+func ExampleGlobalConstantAssignTest() {
+	ast, err := karboscript.ParseString("const float PI = 3.14; function main() { PI = 3; }")
+
+	if err != nil {
+	}
+
+	_, err = karboscript.GetOpcodes(ast)
+
+	fmt.Println(err)
+
+	// Output:
+	// 1:42: can't assign to constant PI!
+}
+
+func ExampleGlobalConstantShadowTest() {
+	ast, err := karboscript.ParseString("const float PI = 3.5; function main() { int PI = 4; PI = 5; out(PI); g(1); k(); } function g(int PI) { PI = 2; out(PI); } function k() { foreach [7] as PI { PI = PI + 1; out(PI); } }")
+
+	if err != nil {
+	}
+
+	opcodes, err := karboscript.GetOpcodes(ast)
+	fmt.Println(err)
+
+	_ = karboscript.Execute(&opcodes)
+
+	// Output:
+	// <nil>
+	// 5
+	// 2
+	// 8
+}
+
+func ExampleTypeCheckTest() {
+	ast, err := karboscript.ParseString("function main() { int a = \"text\"; out(add(1)); out(add(1, \"2\")); string s = add(1, 2); if (a) { out(b); } } function add(int a, int b) int { return a + b; } function name() string { return 10; }")
+
+	if err != nil {
+	}
+
+	_, err = karboscript.GetOpcodes(ast)
+
+	fmt.Println(err)
+
+	// Output:
+	// 1:19: can't assign string to int variable a!
+	// 1:39: add needs 2 arguments, got 1!
+	// 1:59: argument 2 of add has to be int, got string!
+	// 1:66: can't assign int to string variable s!
+	// 1:91: Condition must return bool
+	// 1:101: Undeclared variable: b
+	// 1:183: function name has to return string, got int!
+}
+
+func ExampleTypeCheckCallTest() {
+	ast, err := karboscript.ParseString("function main() { int a = readInt() + len(\"ab\"); float f = float(a) * 2.5; string s = \"x\" + readLine(); out(a, f, s); missing(); }")
+
+	if err != nil {
+	}
+
+	_, err = karboscript.GetOpcodes(ast)
+
+	fmt.Println(err)
+
+	// Output:
+	// 1:119: Can't find missing function!
+}
+
+func ExampleTypeCheckScopeTest() {
+	ast, err := karboscript.ParseString("function main() { if (false) { int y = 1; } out(y); int x = f(); out(x, g(true)); } function f() int { } function g(bool b) int { if (b) { return 1; } else { return 2; } } function out(int a) { }")
+
+	if err != nil {
+	}
+
+	_, err = karboscript.GetOpcodes(ast)
+
+	fmt.Println(err)
+
+	// Output:
+	// 1:173: function out is buildin function
+	// 1:49: Undeclared variable: y
+	// 1:85: function f has to return int!
+}
+
+func ExampleTypeCheckRedeclareTest() {
+	ast, err := karboscript.ParseString("function main() { int x = 1; if (true) { string x = \"a\"; int x = 2; } out(x + 1); foreach [1] as x { } bool c = true; while (c) { bool c = false; } }")
+
+	if err != nil {
+	}
+
+	_, err = karboscript.GetOpcodes(ast)
+
+	fmt.Println(err)
+
+	// Output:
+	// 1:42: variable x is already declared as int!
+	// 1:83: variable x is already declared as int!
+}
+
+func ExampleTypeCheckVoidTest() {
+	ast, err := karboscript.ParseString("function main() { out(1, f()); int x = 1 + f(); array a = [f()]; out(g()); } function f() { out(0); } function g() { if (true) { return 1; } return \"a\"; }")
+
+	if err != nil {
+	}
+
+	_, err = karboscript.GetOpcodes(ast)
+
+	fmt.Println(err)
+
+	// Output:
+	// 1:26: expression doesn't return any value!
+	// 1:42: Can't perform math operation + on int and void!
+	// 1:60: expression doesn't return any value!
+}
+
+func ExampleDiagnosticsTest() {
+	code := "function main() {\n    int a = \"x\";\n    missing(a);\n    continue;\n}"
+	ast, err := karboscript.ParseString(code)
+
+	if err != nil {
+	}
+
+	_, err = karboscript.GetOpcodes(ast)
+
+	for _, diagnostic := range karboscript.GetDiagnostics(err) {
+		fmt.Println(diagnostic.Severity, diagnostic.Line, diagnostic.Column, diagnostic.Message)
+	}
+
+	// Output:
+	// error 2 5 can't assign string to int variable a!
+	// error 3 5 Can't find missing function!
+	// error 4 5 continue used outside of loop!
+}
+
+func ExampleFormatDiagnosticTest() {
+	code := "function main() {\n\tint a = 1;\n\tout(a + b);\n}"
+	ast, err := karboscript.ParseString(code)
+
+	if err != nil {
+	}
+
+	_, err = karboscript.GetOpcodes(ast)
+
+	for _, diagnostic := range karboscript.GetDiagnostics(err) {
+		fmt.Println(karboscript.FormatDiagnostic(diagnostic, code))
+	}
+
+	// Output:
+	// 3:10: error: Undeclared variable: b
+	//     	out(a + b);
+	//     	        ^
+}
+
+func ExampleParseErrorDiagnosticTest() {
+	_, err := karboscript.ParseString("function main() {\n  int a = ;\n}")
+
+	for _, diagnostic := range karboscript.GetDiagnostics(err) {
+		fmt.Println(diagnostic.Line, diagnostic.Column, diagnostic.Message)
+	}
+
+	// Output:
+	// 2 3 unexpected token "int" (expected "}")
+}
+
+func ExampleRuntimeErrorStackTraceTest() {
+	ast, err := karboscript.ParseString("function main() {\n  out(outer(0));\n}\nfunction outer(int a) int {\n  return inner(a) + 1;\n}\nfunction inner(int a) int {\n  return 10 / a;\n}")
+
+	if err != nil {
+	}
+
+	opcodes, _ := karboscript.GetOpcodes(ast)
+	err = karboscript.Execute(&opcodes)
+
+	var runtimeError *karboscript.RuntimeError
+	if errors.As(err, &runtimeError) {
+		fmt.Println(runtimeError.StackTrace())
+		fmt.Println(runtimeError.Opcode.Operation, runtimeError.Stack[1].Function, runtimeError.Stack[1].CallPosition)
+	}
+
+	// Output:
+	// 8:13: Division by 0!
+	//     at inner (8:13)
+	//     at outer (5:10)
+	//     at main (2:7)
+	// exp_call outer 2:7
+}
+
+func ExampleStepBudgetTest() {
+	ast, err := karboscript.ParseString("function main() { int a = 0; while (true) { a++; } }")
+
+	if err != nil {
+	}
+
+	opcodes, _ := karboscript.GetOpcodes(ast)
+	err = karboscript.ExecuteWithOptions(&opcodes, karboscript.ExecuteOptions{MaxSteps: 1000})
+
+	fmt.Println(errors.Is(err, karboscript.ErrStepBudgetExceeded))
+
+	// Output:
+	// true
+}
+
+func ExampleNoStepBudgetTest() {
+	ast, err := karboscript.ParseString("function main() { int a = 0; while (a < 100000) { a++; } out(a); }")
+
+	if err != nil {
+	}
+
+	opcodes, _ := karboscript.GetOpcodes(ast)
+	err = karboscript.Execute(&opcodes)
+
+	fmt.Println(err)
+
+	// Output:
+	// 100000
+	// <nil>
+}
+
+func ExampleExecuteContextCancelTest() {
+	ast, err := karboscript.ParseString("function main() { out(\"not printed\"); }")
+
+	if err != nil {
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	opcodes, _ := karboscript.GetOpcodes(ast)
+	err = karboscript.ExecuteContext(ctx, &opcodes)
+
+	fmt.Println(errors.Is(err, context.Canceled))
+
+	// Output:
+	// true
+}
+
+func ExampleExecuteContextReadTest() {
+	ast, _ := karboscript.ParseString("function main() { out(readLine()); }")
+	opcodes, _ := karboscript.GetOpcodes(ast)
+
+	reader, writer := io.Pipe()
+	input := karboscript.NewInput(reader)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	err := karboscript.ExecuteWithOptions(&opcodes, karboscript.ExecuteOptions{Context: ctx, Input: input})
+	fmt.Println(errors.Is(err, context.DeadlineExceeded))
+
+	// line read by the cancelled run is read by the next one
+	go writer.Write([]byte("late\n"))
+	err = karboscript.ExecuteWithOptions(&opcodes, karboscript.ExecuteOptions{Input: input})
+	fmt.Println(err)
+
+	// Output:
+	// true
+	// late
+	//
+	// <nil>
+}
+
+func ExampleExecuteContextTimeoutTest() {
+	ast, err := karboscript.ParseString("function main() { int a = 0; while (true) { a++; } }")
+
+	if err != nil {
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	opcodes, _ := karboscript.GetOpcodes(ast)
+	err = karboscript.ExecuteContext(ctx, &opcodes)
+
+	var runtimeError *karboscript.RuntimeError
+	fmt.Println(errors.Is(err, context.DeadlineExceeded), errors.As(err, &runtimeError))
+
+	// Output:
+	// true true
+}
+
+func ExampleExecuteStreamsTest() {
+	ast, err := karboscript.ParseString(`function main() {
+		string name = readLine();
+		int age = readInt();
+		string last = readLine();
+		out("Hello " + name, age + 1);
+		out(last);
+		outErr("done");
+	}`)
+
+	if err != nil {
+	}
+
+	var stdout, stderr bytes.Buffer
+	opcodes, _ := karboscript.GetOpcodes(ast)
+	err = karboscript.ExecuteWithOptions(&opcodes, karboscript.ExecuteOptions{
+		Stdin:  strings.NewReader("John\n41\nno new line"),
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+
+	fmt.Println(err)
+	fmt.Printf("%q\n", stdout.String())
+	fmt.Printf("%q\n", stderr.String())
+
+	// Output:
+	// <nil>
+	// "Hello John\n 42\nno new line\n"
+	// "done\n"
+}
+
+func ExampleSharedStdinTest() {
+	ast, _ := karboscript.ParseString(`
+	function next() string {
+		return readLine();
+	}`)
+
+	script, _ := karboscript.Compile(ast)
+	options := karboscript.ExecuteOptions{Input: karboscript.NewInput(strings.NewReader("one\ntwo\n"))}
+
+	first, err := script.CallWithOptions(options, "next")
+	fmt.Printf("%q %v\n", first, err)
+
+	second, err := script.CallWithOptions(options, "next")
+	fmt.Printf("%q %v\n", second, err)
+
+	// Output:
+	// "one\n" <nil>
+	// "two\n" <nil>
+}
+
+func ExampleRuntimeRegisterTest() {
+	runtime := karboscript.NewRuntime()
+
+	runtime.Register("square", karboscript.Signature{Arguments: []string{"int"}, ReturnType: "int"}, func(args []karboscript.Value) (karboscript.Value, error) {
+		return karboscript.IntValue(args[0].Int() * args[0].Int()), nil
+	})
+	runtime.Register("join", karboscript.Signature{ReturnType: "string"}, func(args []karboscript.Value) (karboscript.Value, error) {
+		text := ""
+		for _, arg := range args {
+			text += arg.String()
+		}
+		return karboscript.StringValue(text), nil
+	})
+	runtime.Register("log", karboscript.Signature{Arguments: []string{"any"}}, func(args []karboscript.Value) (karboscript.Value, error) {
+		fmt.Println("log:", args[0])
+		return karboscript.Value{}, nil
+	})
+
+	ast, err := karboscript.ParseString(`function main() {
+		int a = square(4);
+		string s = join("a", 1, true);
+		out(a, s);
+		log([1, 2]);
+	}`)
+
+	if err != nil {
+	}
+
+	opcodes, err := runtime.GetOpcodes(ast)
+	fmt.Println(err)
+	err = runtime.Execute(&opcodes)
+	fmt.Println(err)
+
+	// Output:
+	// <nil>
+	// 16 a1true
+	// log: [1 2]
+	// <nil>
+}
+
+func ExampleRuntimeRegisterErrorsTest() {
+	runtime := karboscript.NewRuntime()
+	noop := func(args []karboscript.Value) (karboscript.Value, error) {
+		return karboscript.Value{}, nil
+	}
+
+	fmt.Println(runtime.Register("out", karboscript.Signature{}, noop))
+	fmt.Println(runtime.Register("f", karboscript.Signature{Arguments: []string{"Point"}}, noop))
+	fmt.Println(runtime.Register("f", karboscript.Signature{}, noop))
+	fmt.Println(runtime.Register("f", karboscript.Signature{}, noop))
+
+	// Output:
+	// Function out is buildin function!
+	// Function f has unknown argument type Point!
+	// <nil>
+	// Function f is already registered!
+}
+
+func ExampleRuntimeCheckTest() {
+	runtime := karboscript.NewRuntime()
+	runtime.Register("half", karboscript.Signature{Arguments: []string{"float"}, ReturnType: "float"}, func(args []karboscript.Value) (karboscript.Value, error) {
+		return karboscript.FloatValue(args[0].Float() / 2), nil
+	})
+	runtime.Register("first", karboscript.Signature{Arguments: []string{"array"}, ReturnType: "int"}, func(args []karboscript.Value) (karboscript.Value, error) {
+		return args[0].Array()[0], nil
+	})
+
+	ast, err := karboscript.ParseString(`function main() { float a = half(1, 2); string b = half(1.0); }`)
+
+	if err != nil {
+	}
+
+	_, err = karboscript.GetOpcodes(ast)
+	fmt.Println(err)
+	_, err = runtime.GetOpcodes(ast)
+	fmt.Println(err)
+
+	ast, err = karboscript.ParseString(`function main() { array a = ["x"]; out(first(a)); }`)
+
+	if err != nil {
+	}
+
+	opcodes, _ := runtime.GetOpcodes(ast)
+	err = runtime.Execute(&opcodes)
+	fmt.Println(err)
+
+	// Output:
+	// 1:29: Can't find half function!
+	// 1:52: Can't find half function!
+	// 1:29: half needs 1 arguments, got 2!
+	// 1:34: argument 1 of half has to be float, got int!
+	// 1:41: can't assign float to string variable b!
+	// 1:40: first has to return int, got string!
+}
+
+func ExampleScriptCallTest() {
+	ast, err := karboscript.ParseString(`
+	int calls = 10;
+
+	struct Point {
+		int x;
+		int y;
+	}
+
+	function add(int a, int b) int {
+		calls++;
+		return a + b + calls;
+	}
+
+	function move(Point p, int d) Point {
+		return Point(p.x + d, p.y + d);
+	}
+
+	function total(map prices, array names) float {
+		float sum = 0.0;
+		foreach names as name {
+			sum += prices[name];
+		}
+		return sum;
+	}
+
+	function point() Point {
+		return Point(1, 2);
+	}
+
+	function hello(string name) {
+		out("Hello " + name);
+	}`)
+
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	script, err := karboscript.Compile(ast)
+	fmt.Println(err)
+
+	fmt.Println(script.Call("add", 1, 2))
+	fmt.Println(script.Call("add", int64(1), uint8(2)))
+	fmt.Println(script.Call("total", map[string]float64{"a": 1.5, "b": 2}, []string{"a", "b", "a"}))
+	fmt.Println(script.Call("point"))
+	fmt.Println(script.Call("hello", "John"))
+
+	point, _ := script.Call("point")
+	fmt.Println(script.Call("move", point, 1))
+	fmt.Println(script.Call("move", struct{ X, Y int }{3, 4}, 1))
+	fmt.Println(script.Call("move", map[string]any{"x": 1}, 1))
+	fmt.Println(script.Call("move", map[string]any{"x": 1, "y": 2, "z": 3}, 1))
+	fmt.Println(script.Call("move", map[string]any{"x": 1, "y": "2"}, 1))
+
+	// Output:
+	// <nil>
+	// 14 <nil>
+	// 15 <nil>
+	// 5 <nil>
+	// map[x:1 y:2] <nil>
+	// Hello John
+	// <nil> <nil>
+	// map[x:2 y:3] <nil>
+	// map[x:4 y:5] <nil>
+	// <nil> argument 1 of move: Point needs field y!
+	// <nil> argument 1 of move: Point has no field z!
+	// <nil> argument 1 of move: Point.y: variable is not int!
+}
+
+func ExampleScriptGlobalsTest() {
+	ast, _ := karboscript.ParseString(`
+	int counter = start();
+
+	function start() int {
+		out("initialized");
+		return 0;
+	}
+
+	function count() int {
+		counter++;
+		return counter;
+	}`)
+
+	script, err := karboscript.Compile(ast)
+	fmt.Println(err)
+
+	fmt.Println(script.Call("count"))
+	fmt.Println(script.Call("count"))
+
+	// Output:
+	// <nil>
+	// initialized
+	// 1 <nil>
+	// 2 <nil>
+}
+
+func ExampleScriptGlobalsErrorTest() {
+	ast, _ := karboscript.ParseString(`
+	int zero = 0;
+	int counter = start() / zero;
+
+	function start() int {
+		out("initialized");
+		return 1;
+	}
+
+	function count() int {
+		counter++;
+		return counter;
+	}`)
+
+	script, err := karboscript.Compile(ast)
+	fmt.Println(err)
+
+	fmt.Println(script.Call("count"))
+	fmt.Println(script.Call("count"))
+
+	// Output:
+	// <nil>
+	// initialized
+	// <nil> 3:24: Division by 0!
+	// <nil> 3:24: Division by 0!
+}
+
+func ExampleScriptCallErrorsTest() {
+	ast, err := karboscript.ParseString(`
+	function half(int a) int {
+		return a / 2;
+	}
+
+	function broken(int a) int {
+		return a / 0;
+	}`)
+
+	if err != nil {
+	}
+
+	script, _ := karboscript.Compile(ast)
+
+	fmt.Println(script.Call("missing"))
+	fmt.Println(script.Call("half"))
+	fmt.Println(script.Call("half", "a"))
+	fmt.Println(script.Call("half", struct{}{}))
+	fmt.Println(script.Call("broken", 1))
+
+	// Output:
+	// <nil> Can't find missing function!
+	// <nil> half needs 1 arguments, got 0!
+	// <nil> argument 1 of half has to be int, got string!
+	// <nil> argument 1 of half: Can't convert struct {} to script value!
+	// <nil> 7:12: Division by 0!
+}
+
+func ExampleFunctionArgumentsOrderTest() {
+	ast, err := karboscript.ParseString(`
+	function main() {
+		out(sub(10, 3), repeat("ab", 3));
+	}
+
+	function sub(int a, int b) int {
+		return a - b;
+	}
+
+	function repeat(string s, int count) string {
+		string result = "";
+		for (int i = 0; i < count; i++;) {
+			result += s;
+		}
+		return result;
+	}`)
+
+	if err != nil {
+	}
+
+	opcodes, _ := karboscript.GetOpcodes(ast)
+	karboscript.Execute(&opcodes)
+
+	// Output:
+	// 7 ababab
+}
+
+func ExampleValueTest() {
+	values := []any{1, 2.5, "text", true, []int{1, 2}, map[string]bool{"b": false, "a": true}}
+
+	for _, value := range values {
+		converted, err := karboscript.ValueOf(value)
+		fmt.Println(converted.TypeName(), converted, converted.Interface(), err)
+	}
+
+	_, err := karboscript.ValueOf(struct{}{})
+	fmt.Println(err)
+
+	// Output:
+	// int 1 1 <nil>
+	// float 2.5 2.5 <nil>
+	// string text text <nil>
+	// bool true true <nil>
+	// array [1 2] [1 2] <nil>
+	// map map[a:true b:false] map[a:true b:false] <nil>
+	// Can't convert struct {} to script value!
+}
+
+func ExampleBytecodeTest() {
+	ast, _ := karboscript.ParseString(`
+	function main() {
+		float half = 1.5;
+		map m = {"a": 1};
+		foreach m as key, value {
+			out(key, value, half, true, double(value));
+		}
+	}
+
+	function double(int a) int {
+		return a * 2;
+	}`)
+
+	opcodes, _ := karboscript.GetOpcodes(ast)
+
+	var file bytes.Buffer
+	err := karboscript.WriteBytecode(&file, opcodes)
+	fmt.Println(err)
+
+	loaded, err := karboscript.ReadBytecode(bytes.NewReader(file.Bytes()))
+	fmt.Println(err, len(loaded) == len(opcodes))
+
+	karboscript.Execute(&loaded)
+
+	incompatible := append([]byte{}, file.Bytes()...)
+	incompatible[5]++
+	_, err = karboscript.ReadBytecode(bytes.NewReader(incompatible))
+	fmt.Println(err)
+
+	_, err = karboscript.ReadBytecode(strings.NewReader("function main() {}"))
+	fmt.Println(err)
+
+	_, err = karboscript.ReadBytecode(bytes.NewReader(file.Bytes()[:file.Len()/2]))
+	fmt.Println(err)
+
+	// Output:
+	// <nil>
+	// <nil> true
+	// a 1 1.5 true 2
+	// Bytecode version 3 is not supported, this karboscript runs version 2, build the script again!
+	// File is not KarboScript bytecode!
+	// Broken bytecode file!
+}
+
+func ExampleAssemblyTest() {
+	opcodes, err := karboscript.Assemble(`
+	; prints numbers from 3 to 1 and sum of two floats
+	_start: start
+		push_exp ( 3 )
+		set_local_var_exp ( int i )
+	loop:
+		while_start
+		push_exp_var ( i )
+		push_exp ( 0 )
+		exp_call ( > )
+		while ( end )
+		push_exp_var ( i )
+		push_exp ( "a b" )
+		call_function ( out 2 )
+		drop
+		push_exp_var ( i )
+		push_exp ( 1 )
+		exp_call ( - )
+		set_local_var_exp ( "" i ) @ "test.ksa:14:3"
+		jmp ( loop )
+	end: while_else
+		push_exp ( 1.5 )
+		push_exp ( 2.0 )
+		exp_call ( + )
+		call_function ( out 1 )
+		drop
+		exit`)
+	fmt.Println(err)
+
+	listing := karboscript.Disassemble(opcodes)
+	fmt.Print(listing[:strings.Index(listing, "loop:")])
+
+	again, err := karboscript.Assemble(listing)
+	fmt.Println(err, karboscript.Disassemble(again) == listing)
+
+	karboscript.Execute(&again)
+
+	_, err = karboscript.Assemble("push_exp ( 1 2 )")
+	fmt.Println(err)
+
+	_, err = karboscript.Assemble("\njump ( end )")
+	fmt.Println(err)
+
+	_, err = karboscript.Assemble("jmp ( end )")
+	fmt.Println(err)
+
+	// Output:
+	// <nil>
+	// _start: start
+	// push_exp ( 3 )
+	// set_local_var_exp ( int i )
+	// <nil> true
+	// 3 a b
+	// 2 a b
+	// 1 a b
+	// 3.5
+	// line 1: push_exp needs 1 operands, got 2!
+	// line 2: Unknown operation jump!
+	// can't find label: end
+}
+
+func ExampleOptimizeTest() {
+	ast, _ := karboscript.ParseString(`
+	function main() {
+		int i = 0;
+		while (i < 2) {
+			i++;
+			if (i == 1) {
+				out(1000 + 2 * 3);
+			} else {
+				out("a" + "b");
+			}
+		}
+	}`)
+
+	opcodes, _ := karboscript.GetOpcodes(ast)
+	optimized, err := karboscript.Optimize(opcodes)
+	fmt.Println(err, len(optimized) < len(opcodes))
+
+	for _, opcode := range optimized {
+		if opcode.Operation == karboscript.OpPushExp || opcode.Operation == karboscript.OpJmp {
+			fmt.Println(strings.Split(opcode.String(), " @")[0])
+		}
+	}
+
+	karboscript.Execute(&optimized)
+
+	// Output:
+	// <nil> true
+	// push_exp ( 0 )
+	// push_exp ( 2 )
+	// push_exp ( 1 )
+	// push_exp ( 1 )
+	// push_exp ( 1006 )
+	// jmp ( _while.3 )
+	// push_exp ( "ab" )
+	// jmp ( _while.3 )
+	// 1006
+	// ab
+}
+
+func ExampleRecursionTest() {
+	ast, _ := karboscript.ParseString(`
+	int depth = 0;
+
+	function main() {
+		out(fibonacci(10), depth);
+		int depth = 1;
+		out(depth);
+	}
+
+	function fibonacci(int n) int {
+		depth = depth + 1;
+		int a = n;
+		if (n < 2) {
+			return n;
+		}
+		int result = fibonacci(n - 1) + fibonacci(n - 2);
+		out(a == n);
+		return result;
+	}`)
+
+	opcodes, _ := karboscript.GetOpcodes(ast)
+	var output bytes.Buffer
+	err := karboscript.ExecuteWithOptions(&opcodes, karboscript.ExecuteOptions{Stdout: &output})
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	fmt.Println(err, strings.Count(output.String(), "true") == len(lines)-2)
+	fmt.Println(strings.Join(lines[len(lines)-2:], "\n"))
+
+	// Output:
+	// <nil> true
+	// 55 177
+	// 1
+}
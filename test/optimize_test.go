@@ -0,0 +1,115 @@
+package test
+
+import (
+	karboscript "karboScript/src"
+
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// optimizerScripts are run with and without optimization, they cover every statement and
+// expression which optimizer can change
+var optimizerScripts = []string{
+	"function main() { for int i=0; i<10; i=i+1; { if (i == 1) { continue; } if (i == 4) { break; } out(i); } }",
+	"function main() { from 0 to 3 as i { from 0 to 10 as j { if (j == 1) { continue; } if (j == 3) { break; } out(i, j); } } }",
+	"function main() { int a = 0; while (a < 10) { a = a + 1; if (a == 2) { continue; } if (a == 5) { break; } out(a); } }",
+	"\n\tfunction main() {\n\t\tfloat half = 1.5;\n\t\tmap m = {\"a\": 1};\n\t\tforeach m as key, value {\n\t\t\tout(key, value, half, true, double(value));\n\t\t}\n\t}\n\n\tfunction double(int a) int {\n\t\treturn a * 2;\n\t}",
+	"function main() { out(12 > 10, 10 == 10, 30 == 10, 10 != 10); }",
+	"function main() { array a = [1, 2, 3]; int i = 0; a[i + 1] += 10; a[2] *= a[1]; a[0]++; a[0]++; out(a[0], a[1], a[2]); for int j = 0; j < 3; j++; { out(j); } }",
+	"function main() { int a = 10; a += 5; a -= 3; a *= 2; a /= 4; a %= 4; out(a); a++; a++; a--; out(a); float f = 1.0; f += 1; out(f); }",
+	"function main() {    int a = 1;    int b = 1;    while (a < 3) {        b = 1;        while (b < 3) {            out (a, b);            b=b+1;        }        a=a+1;    }}",
+	"function main() { out(\"not printed\"); }",
+	"function main() { out(readLine()); }",
+	"function main() {\n\t\tstring name = readLine();\n\t\tint age = readInt();\n\t\tstring last = readLine();\n\t\tout(\"Hello \" + name, age + 1);\n\t\tout(last);\n\t\toutErr(\"done\");\n\t}",
+	"function main() { out(12 + 14); }",
+	"function main() { out(1000 + test() * 2 + 22); } function test() { return 100;}",
+	"function main() { float a = 1.5; out(a * 2.0, a + 1, 10 / 4.0, 2 - 0.5, a > 1, a == 1.5, 3 <= 2.5); }",
+	"function main() {    for int i=0; i<10; i=i+1; {        out(i);    }}",
+	"function main() {    from 0 to 10 as i {        out(i);    }}",
+	"function main() { array a = [\"a\", \"b\", \"c\"]; foreach a as item { out(item); } foreach a as i, item { if (i == 1) { continue; } out(i, item); } }",
+	"function main() { array a = [1, 2, 3]; foreach a as item { a[] = item * 10; if (item == 2) { break; } } out(len(a), a[3], a[4]); }",
+	"function main() { map m = {\"one\": 1, \"two\": 2, \"three\": 3}; foreach m as key, value { delete(m, \"three\"); out(key, value); } foreach m as value { out(value); } }",
+	"function main() { out(a1(), a2()); }function a1() { return 12; }function a2() { return 55; }",
+	"function main() { out(1000 + test(123) * 2 + 22, test(123)); } function test(int test) { return test + 200;}",
+	"\n\tfunction main() {\n\t\tout(sub(10, 3), repeat(\"ab\", 3));\n\t}\n\n\tfunction sub(int a, int b) int {\n\t\treturn a - b;\n\t}\n\n\tfunction repeat(string s, int count) string {\n\t\tstring result = \"\";\n\t\tfor (int i = 0; i < count; i++;) {\n\t\t\tresult += s;\n\t\t}\n\t\treturn result;\n\t}",
+	"const float PI = 3.5; function main() { out(PI * 2); }",
+	"int counter = 10; function main() { add(); add(); out(counter); int counter = 1; out(counter); } function add() { counter += 1; } array names = [\"a\"];",
+	"function main() {    if (10 == 10) {        out(\"10 == 10\");    }    if (500 < 200) {        out(\"500 < 200\");    }    if (12 > 10) {        out(\"12 > 10\");    }}\t",
+	"function main() {    if (10 == 12) {        out(\"first\");    } else {        out(\"second\");    }    if (12 > 10) {        out(\"third\");    } else {        out(\"fourth\");    }}",
+	"function main() {    from 0 to 4 as i {        if (i == 0) {            out(\"zero\");        } else if (i == 1) {            out(\"one\");        } else if (i == 2) {            out(\"two\");        } else {            out(\"many\");        }    }}",
+	"function test() { int a = 100; int aaa = 12 + a; return aaa;} function main() { out(test());}\t",
+	"function main() { out(true && false, true || false, !false, 1 < 2 && 2 < 3 || false, !(1 == 1) || 2 > 3); }",
+	"function main() { if (false && loud(\"and\")) { out(\"no\"); } if (true || loud(\"or\")) { out(\"yes\"); } if (true && loud(\"called\")) { out(\"done\"); } } function loud(string text) bool { out(text); return true; }",
+	"function main() { map m = {\"a\": 1, \"b\": 2}; m[\"c\"] = 3; m[\"a\"] += 10; out(m[\"a\"], m[\"c\"], len(m), has(m, \"b\"), has(m, \"x\")); delete(m, \"b\"); out(m); }",
+	"function main() { map m = make(); array k = keys(m); from 0 to len(k) as i { out(k[i], m[k[i]]); } } function make() map { map m = {}; m[3] = \"three\"; m[1] = \"one\"; m[2] = \"two\"; return m; }",
+	"function main() { map m = {\"a\": 1}; out(m[\"b\"]); }",
+	"function main() { array a = [1, 2, 3]; a[-1] = 5; }",
+	"function main() {    int a = 5;    if (a > 3) {        if (a > 10) {            out(\"big\");        } else if (a == 5) {            out(\"five\");        } else {            out(\"medium\");        }    } else {        out(\"small\");    }}",
+	"struct Point { int x; int y; } struct Line { Point a; Point b; } function main() { Line l = Line(Point(1, 2), Point(3, 4)); l.b.x = 10; out(length(l)); Point m = move(l.a); out(m.x, l.a.x); } function length(Line l) int { return l.b.x - l.a.x + l.b.y - l.a.y; } function move(Point p) Point { p.x++; return p; }",
+	"function main() { int a = int(7.9); float b = float(3); out(a, b / 2, int(\"42\") + 1, float(\"0.25\") * 4); }",
+	"\n\tfunction main() {\n\t\tint i = 0;\n\t\twhile (i < 2) {\n\t\t\ti++;\n\t\t\tif (i == 1) {\n\t\t\t\tout(1000 + 2 * 3);\n\t\t\t} else {\n\t\t\t\tout(\"a\" + \"b\");\n\t\t\t}\n\t\t}\n\t}",
+	"\n\tint depth = 0;\n\n\tfunction main() {\n\t\tout(fibonacci(10), depth);\n\t\tint depth = 1;\n\t\tout(depth);\n\t}\n\n\tfunction fibonacci(int n) int {\n\t\tdepth = depth + 1;\n\t\tint a = n;\n\t\tif (n < 2) {\n\t\t\treturn n;\n\t\t}\n\t\tint result = fibonacci(n - 1) + fibonacci(n - 2);\n\t\tout(a == n);\n\t\treturn result;\n\t}",
+	"function main() {\n  out(outer(0));\n}\nfunction outer(int a) int {\n  return inner(a) + 1;\n}\nfunction inner(int a) int {\n  return 10 / a;\n}",
+	"function main() { string a = \"karbo\"; string r = \"\"; from 0 to 5 as i { r = a[i] + r; } out(a[0], r); }",
+	"function main() { string a = \"hello\"; string b = a + \" \" + \"world\"; out(b, a == \"hello\", a != \"hello\", \"abc\" < \"abd\", \"b\" > \"abc\", true == true, true != false); }",
+	"struct Point { int x; int y; } function main() { Point p = Point(1, 2); p.x = 5; p.y += 10; out(p.x, p.y, p); }",
+	"function main() {    array a = [1,2,3];    a[1] = 5;    out(a[1]);}",
+	"function main() {    array a = [1,2,3]; array b = [4,5,6];    a[1] = b[1];    out(a[1]);}",
+	"function main() {    array a = [1,2,3]; a[] = 20;    out(a[3]);}",
+	"function main() { int a = 7; float b = -1.5; out(-a, -3 + 10, 2 - -2, -(a + 1) * 2, b, 17 % 5, -7 % 3, 5.5 % 2); }",
+	"function main() {    int a = 0;    while (a < 10) {        out (a);        a = a + 1;    }}",
+}
+
+func runForOutput(opcodes []*karboscript.Opcode) (string, error) {
+	var output bytes.Buffer
+
+	err := karboscript.ExecuteWithOptions(&opcodes, karboscript.ExecuteOptions{
+		MaxSteps: 1000000,
+		Stdin:    strings.NewReader("5\nline\n"),
+		Stdout:   &output,
+		Stderr:   &output,
+	})
+
+	return output.String(), err
+}
+
+func TestOptimizeKeepsOutputOfExamples(t *testing.T) {
+	optimizedCount := 0
+
+	for _, source := range optimizerScripts {
+		ast, err := karboscript.ParseString(source)
+		if err != nil {
+			t.Fatalf("%v\n%s", err, source)
+		}
+
+		opcodes, err := karboscript.GetOpcodes(ast)
+		if err != nil {
+			t.Fatalf("%v\n%s", err, source)
+		}
+
+		optimized, err := karboscript.Optimize(opcodes)
+		if err != nil {
+			t.Fatalf("%v\n%s", err, source)
+		}
+
+		if len(optimized) < len(opcodes) {
+			optimizedCount++
+		}
+
+		expected, expectedErr := runForOutput(opcodes)
+		if errors.Is(expectedErr, karboscript.ErrStepBudgetExceeded) {
+			continue
+		}
+
+		output, err := runForOutput(optimized)
+		if output != expected || (err == nil) != (expectedErr == nil) || (err != nil && err.Error() != expectedErr.Error()) {
+			t.Errorf("optimized script has different output\n%s\nexpected: %q %v\ngot: %q %v", source, expected, expectedErr, output, err)
+		}
+	}
+
+	if optimizedCount == 0 {
+		t.Error("no script was optimized")
+	}
+}